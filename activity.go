@@ -0,0 +1,405 @@
+package lifting
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+const (
+	// earthRadius in meters, used for the haversine distance between points.
+	earthRadius = 6371008.8
+	// metersPerMile converts between the track's meters and the miles we log.
+	metersPerMile = 1609.344
+	metersPerKm   = 1000
+	metersPerYard = 0.9144
+	// stoppedSpeed is the speed in meters per second below which we consider
+	// you to be standing around rather than moving.
+	stoppedSpeed = 0.5
+)
+
+// TrackPoint is a single sample from a recorded track.
+type TrackPoint struct {
+	Latitude, Longitude float64
+	// Elevation in meters above sea level.
+	Elevation float64
+	// Distance is the cumulative distance in meters reported by the device,
+	// zero if the file doesn't carry one.
+	Distance  float64
+	Time      time.Time
+	HeartRate int
+	// HasPosition is false for points recorded without a gps fix, e.g. on a
+	// treadmill.
+	HasPosition bool
+}
+
+// Activity is an endurance activity recorded by a watch or phone, e.g. a run
+// or a ride, parsed from a GPX or TCX file.
+type Activity struct {
+	Name   string
+	Sport  string
+	Points []TrackPoint
+	// DeviceDistance is true if the device recorded its own cumulative
+	// distance, which is more accurate than anything we compute from
+	// positions.
+	DeviceDistance bool
+}
+
+// Track is the original file an imported repetition was computed from, kept so
+// it can be displayed later.
+type Track struct {
+	RepetitionID int `db:"workout_id"`
+	// Format is the file format, "gpx" or "tcx".
+	Format string
+	Data   []byte
+}
+
+type gpxFile struct {
+	Name   string `xml:"metadata>name"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []struct {
+				Lat       float64 `xml:"lat,attr"`
+				Lon       float64 `xml:"lon,attr"`
+				Elevation float64 `xml:"ele"`
+				Time      string  `xml:"time"`
+				HeartRate int     `xml:"extensions>TrackPointExtension>hr"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		Notes string `xml:"Notes"`
+		Laps  []struct {
+			Points []struct {
+				Time      string   `xml:"Time"`
+				Latitude  *float64 `xml:"Position>LatitudeDegrees"`
+				Longitude *float64 `xml:"Position>LongitudeDegrees"`
+				Altitude  float64  `xml:"AltitudeMeters"`
+				Distance  float64  `xml:"DistanceMeters"`
+				HeartRate int      `xml:"HeartRateBpm>Value"`
+			} `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+func parseTrackTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(value))
+}
+
+// ParseGPX reads an activity from a GPX file.
+func ParseGPX(r io.Reader) (*Activity, error) {
+	var f gpxFile
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("parsing gpx: %v", err)
+	}
+
+	a := &Activity{Name: f.Name}
+	for _, trk := range f.Tracks {
+		if a.Name == "" {
+			a.Name = trk.Name
+		}
+		if a.Sport == "" {
+			a.Sport = trk.Type
+		}
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				t, err := parseTrackTime(p.Time)
+				if err != nil {
+					return nil, fmt.Errorf("parsing gpx: %v", err)
+				}
+				a.Points = append(a.Points, TrackPoint{
+					Latitude:    p.Lat,
+					Longitude:   p.Lon,
+					Elevation:   p.Elevation,
+					Time:        t,
+					HeartRate:   p.HeartRate,
+					HasPosition: true,
+				})
+			}
+		}
+	}
+
+	if len(a.Points) == 0 {
+		return nil, fmt.Errorf("parsing gpx: no track points")
+	}
+	return a, nil
+}
+
+// ParseTCX reads an activity from a Garmin Training Center (TCX) file. Only
+// the first activity in the file is used.
+func ParseTCX(r io.Reader) (*Activity, error) {
+	var f tcxFile
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("parsing tcx: %v", err)
+	}
+
+	if len(f.Activities) == 0 {
+		return nil, fmt.Errorf("parsing tcx: no activities")
+	}
+
+	activity := f.Activities[0]
+	a := &Activity{Name: activity.Notes, Sport: activity.Sport}
+	for _, lap := range activity.Laps {
+		for _, p := range lap.Points {
+			t, err := parseTrackTime(p.Time)
+			if err != nil {
+				return nil, fmt.Errorf("parsing tcx: %v", err)
+			}
+			point := TrackPoint{
+				Elevation: p.Altitude,
+				Distance:  p.Distance,
+				Time:      t,
+				HeartRate: p.HeartRate,
+			}
+			if p.Latitude != nil && p.Longitude != nil {
+				point.Latitude = *p.Latitude
+				point.Longitude = *p.Longitude
+				point.HasPosition = true
+			}
+			a.Points = append(a.Points, point)
+			a.DeviceDistance = a.DeviceDistance || p.Distance > 0
+		}
+	}
+
+	if len(a.Points) == 0 {
+		return nil, fmt.Errorf("parsing tcx: no track points")
+	}
+	return a, nil
+}
+
+// ActivityFormat figures out the track format from a file name, returning "gpx",
+// "tcx" or an error.
+func ActivityFormat(filename string) (string, error) {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	switch format {
+	case "gpx", "tcx":
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported activity file %q, expected .gpx or .tcx", filename)
+}
+
+// ParseActivity parses the activity in the given format.
+func ParseActivity(format string, r io.Reader) (*Activity, error) {
+	switch format {
+	case "gpx":
+		return ParseGPX(r)
+	case "tcx":
+		return ParseTCX(r)
+	}
+	return nil, fmt.Errorf("unsupported activity format %q", format)
+}
+
+func haversine(a, b TrackPoint) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+	lat1, lat2 := toRadians(a.Latitude), toRadians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := toRadians(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// segment returns the distance in meters between point i-1 and i.
+func (a *Activity) segment(i int) float64 {
+	prev, cur := a.Points[i-1], a.Points[i]
+	if a.DeviceDistance {
+		return math.Max(cur.Distance-prev.Distance, 0)
+	}
+	if !prev.HasPosition || !cur.HasPosition {
+		return 0
+	}
+	return haversine(prev, cur)
+}
+
+// Distance is the total distance covered in meters.
+func (a *Activity) Distance() float64 {
+	total := 0.0
+	for i := 1; i < len(a.Points); i++ {
+		total += a.segment(i)
+	}
+	return total
+}
+
+// MovingTime is the time spent moving, excluding stretches where you were
+// stopped at a light or paused the watch.
+func (a *Activity) MovingTime() time.Duration {
+	var moving time.Duration
+	for i := 1; i < len(a.Points); i++ {
+		prev, cur := a.Points[i-1], a.Points[i]
+		if prev.Time.IsZero() || cur.Time.IsZero() {
+			continue
+		}
+		elapsed := cur.Time.Sub(prev.Time)
+		if elapsed <= 0 {
+			continue
+		}
+		if a.segment(i)/elapsed.Seconds() >= stoppedSpeed {
+			moving += elapsed
+		}
+	}
+	return moving
+}
+
+// ElevationGain is the total climbing in meters.
+func (a *Activity) ElevationGain() float64 {
+	gain := 0.0
+	for i := 1; i < len(a.Points); i++ {
+		if delta := a.Points[i].Elevation - a.Points[i-1].Elevation; delta > 0 {
+			gain += delta
+		}
+	}
+	return gain
+}
+
+// AverageHeartRate is the mean heart rate over the points that recorded one,
+// zero if none did.
+func (a *Activity) AverageHeartRate() int {
+	total, count := 0, 0
+	for _, p := range a.Points {
+		if p.HeartRate > 0 {
+			total += p.HeartRate
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return int(math.Round(float64(total) / float64(count)))
+}
+
+// Start is when the activity began, zero if the file has no timestamps.
+func (a *Activity) Start() time.Time {
+	for _, p := range a.Points {
+		if !p.Time.IsZero() {
+			return p.Time
+		}
+	}
+	return time.Time{}
+}
+
+// metersPer converts a distance unit into meters.
+func metersPer(units string) (float64, error) {
+	switch strings.ToLower(units) {
+	case "miles", "mile", "mi":
+		return metersPerMile, nil
+	case "km", "kilometers":
+		return metersPerKm, nil
+	case "m", "meters":
+		return 1, nil
+	case "yards", "yd":
+		return metersPerYard, nil
+	}
+	return 0, fmt.Errorf("unsupported distance units %q", units)
+}
+
+// Pace is the average moving time per unit of distance, e.g. per mile.
+func (a *Activity) Pace(units string) (time.Duration, error) {
+	per, err := metersPer(units)
+	if err != nil {
+		return 0, err
+	}
+	distance := a.Distance() / per
+	if distance == 0 {
+		return 0, nil
+	}
+	return time.Duration(float64(a.MovingTime()) / distance), nil
+}
+
+// exerciseForSport maps a device's sport name onto how we usually name the
+// exercise in the log.
+func exerciseForSport(sport string) string {
+	switch strings.ToLower(sport) {
+	case "running", "run", "":
+		return "run"
+	case "biking", "cycling", "ride":
+		return "ride"
+	}
+	return strings.ToLower(sport)
+}
+
+// Repetition summarizes the activity as a repetition in the given category,
+// with the distance as volume in units (miles or km) and the moving time as
+// elapsed. The elevation gain, pace and heart rate go in the comment.
+func (a *Activity) Repetition(category, units string) (Repetition, error) {
+	per, err := metersPer(units)
+	if err != nil {
+		return Repetition{}, err
+	}
+
+	start := a.Start()
+	if start.IsZero() {
+		return Repetition{}, fmt.Errorf("activity %q has no timestamps", a.Name)
+	}
+
+	moving := a.MovingTime()
+	if moving >= 24*time.Hour {
+		return Repetition{}, fmt.Errorf("activity %q is longer than a day", a.Name)
+	}
+
+	pace, err := a.Pace(units)
+	if err != nil {
+		return Repetition{}, err
+	}
+
+	details := []string{fmt.Sprintf("%.0fm elevation gain", a.ElevationGain())}
+	if pace > 0 {
+		details = append(details, fmt.Sprintf("%s/%s pace", Pace(pace), units))
+	}
+	if hr := a.AverageHeartRate(); hr > 0 {
+		details = append(details, fmt.Sprintf("average heart rate %d", hr))
+	}
+	comment := strings.Join(details, ", ")
+	if a.Name != "" {
+		comment = a.Name + ": " + comment
+	}
+
+	return Repetition{
+		Exercise:    exerciseForSport(a.Sport),
+		SessionDate: civil.DateOf(start.Local()),
+		Units:       units,
+		Volume:      math.Round(a.Distance()/per*100) / 100,
+		Elapsed: civil.Time{
+			Hour:   int(moving.Hours()),
+			Minute: int(moving.Minutes()) % 60,
+			Second: int(moving.Seconds()) % 60,
+		},
+		Category: category,
+		Comment:  comment,
+	}, nil
+}
+
+// ImportActivity parses the track in data, logs it as a repetition and keeps
+// the original file attached to it, both or neither. The stored repetition is
+// returned.
+func ImportActivity(ctx context.Context, s ContextStorage, format string, data []byte, category, units string) (Repetition, error) {
+	activity, err := ParseActivity(format, bytes.NewReader(data))
+	if err != nil {
+		return Repetition{}, err
+	}
+
+	rep, err := activity.Repetition(category, units)
+	if err != nil {
+		return rep, err
+	}
+
+	err = s.LoadWithTrack(ctx, &rep, Track{Format: format, Data: data})
+	return rep, err
+}
@@ -0,0 +1,137 @@
+package lifting
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <metadata><name>Morning Run</name></metadata>
+  <trk>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="47.6000" lon="-122.3000"><ele>10</ele><time>2018-12-20T16:00:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>140</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="47.6090" lon="-122.3000"><ele>20</ele><time>2018-12-20T16:05:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>150</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="47.6090" lon="-122.3000"><ele>15</ele><time>2018-12-20T16:10:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>160</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+const testTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2018-12-21T16:00:00Z</Id>
+      <Lap StartTime="2018-12-21T16:00:00Z">
+        <Track>
+          <Trackpoint>
+            <Time>2018-12-21T16:00:00Z</Time>
+            <AltitudeMeters>5</AltitudeMeters>
+            <DistanceMeters>0</DistanceMeters>
+            <HeartRateBpm><Value>120</Value></HeartRateBpm>
+          </Trackpoint>
+          <Trackpoint>
+            <Time>2018-12-21T16:10:00Z</Time>
+            <AltitudeMeters>25</AltitudeMeters>
+            <DistanceMeters>5000</DistanceMeters>
+            <HeartRateBpm><Value>130</Value></HeartRateBpm>
+          </Trackpoint>
+        </Track>
+      </Lap>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+func TestParseGPX(t *testing.T) {
+	a, err := ParseGPX(strings.NewReader(testGPX))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Name != "Morning Run" || len(a.Points) != 3 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", a))
+	}
+
+	// 0.009 degrees of latitude is about a kilometer.
+	if d := a.Distance(); d < 995 || d > 1005 {
+		t.Fatal("unexpected distance", d)
+	}
+
+	// the last five minutes were spent standing still.
+	if moving := a.MovingTime(); moving != 5*time.Minute {
+		t.Fatal("unexpected moving time", moving)
+	}
+
+	if gain := a.ElevationGain(); gain != 10 {
+		t.Fatal("unexpected elevation gain", gain)
+	}
+
+	if hr := a.AverageHeartRate(); hr != 150 {
+		t.Fatal("unexpected heart rate", hr)
+	}
+
+	rep, err := a.Repetition("aerobic", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Exercise != "run" || rep.Volume != 1 || rep.Units != "km" ||
+		rep.Elapsed != (civil.Time{Minute: 5}) || rep.Category != "aerobic" {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", rep))
+	}
+}
+
+func TestParseTCX(t *testing.T) {
+	a, err := ParseTCX(strings.NewReader(testTCX))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.DeviceDistance {
+		t.Fatal("expected the device's distance to be used")
+	}
+	if d := a.Distance(); d != 5000 {
+		t.Fatal("unexpected distance", d)
+	}
+
+	pace, err := a.Pace("km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pace != 2*time.Minute {
+		t.Fatal("unexpected pace", pace)
+	}
+
+	rep, err := a.Repetition("aerobic", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Exercise != "ride" || rep.Volume != 5 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", rep))
+	}
+}
+
+func TestActivityFormat(t *testing.T) {
+	for name, expected := range map[string]string{"a.gpx": "gpx", "B.TCX": "tcx"} {
+		format, err := ActivityFormat(name)
+		if err != nil || format != expected {
+			t.Fatal("mimsatch", name, format, err)
+		}
+	}
+
+	if _, err := ActivityFormat("run.fit"); err == nil {
+		t.Fatal("expected an error for a .fit file")
+	}
+}
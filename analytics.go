@@ -0,0 +1,342 @@
+package lifting
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+// Pace is the time taken to cover one unit of distance, e.g. a mile.
+type Pace time.Duration
+
+func (p Pace) String() string {
+	d := time.Duration(p).Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// MarshalText formats the pace as minutes:seconds.
+func (p Pace) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Duration converts the Elapsed time of day into how long the repetition took.
+func (r Repetition) Duration() time.Duration {
+	return time.Duration(r.Elapsed.Hour)*time.Hour +
+		time.Duration(r.Elapsed.Minute)*time.Minute +
+		time.Duration(r.Elapsed.Second)*time.Second +
+		time.Duration(r.Elapsed.Nanosecond)
+}
+
+// IsDistance is true if the repetition's units measure distance, e.g. miles.
+func (r Repetition) IsDistance() bool {
+	_, err := metersPer(r.Units)
+	return err == nil
+}
+
+// Meters is the distance a single set of the repetition covered, zero if its
+// units aren't a distance.
+func (r Repetition) Meters() float64 {
+	per, err := metersPer(r.Units)
+	if err != nil {
+		return 0
+	}
+	return r.Volume * per
+}
+
+// Pace is the time per unit of distance, in the repetition's own units. It is
+// zero unless the repetition is a distance with an elapsed time.
+func (r Repetition) Pace() Pace {
+	if !r.IsDistance() || r.Volume <= 0 {
+		return 0
+	}
+	return Pace(float64(r.Duration()) / r.Volume)
+}
+
+// Speed is the distance per hour in the repetition's own units, zero unless
+// the repetition is a distance with an elapsed time.
+func (r Repetition) Speed() float64 {
+	hours := r.Duration().Hours()
+	if !r.IsDistance() || hours == 0 {
+		return 0
+	}
+	return r.Volume / hours
+}
+
+// Tonnage is the weight moved in a single set of the repetition, its weight
+// times its volume, zero for a distance.
+func (r Repetition) Tonnage() float64 {
+	if r.IsDistance() {
+		return 0
+	}
+	return float64(r.Weight) * r.Volume
+}
+
+// distanceIn converts the total distance of the repetition, including all its
+// sets, into the given units.
+func (r Repetition) distanceIn(units string) float64 {
+	per, err := metersPer(units)
+	if err != nil {
+		return 0
+	}
+	sets := r.Sets
+	if sets < 1 {
+		sets = 1
+	}
+	return r.Meters() * float64(sets) / per
+}
+
+// StandardDistance is a distance people like to race or time themselves over.
+type StandardDistance struct {
+	Name   string
+	Meters float64
+}
+
+// StandardDistances are the distances we look for best efforts over.
+var StandardDistances = []StandardDistance{
+	{Name: "mile", Meters: metersPerMile},
+	{Name: "5k", Meters: 5 * metersPerKm},
+	{Name: "10k", Meters: 10 * metersPerKm},
+	{Name: "half marathon", Meters: 21.0975 * metersPerKm},
+	{Name: "marathon", Meters: 42.195 * metersPerKm},
+}
+
+// BestEffort is the fastest you've covered a standard distance for an
+// exercise, based on the quickest repetition at least that long.
+type BestEffort struct {
+	Exercise string
+	Distance StandardDistance
+	// Time is how long the distance took at the repetition's average pace.
+	Time       time.Duration
+	Repetition Repetition
+}
+
+// BestEfforts finds the best effort for each exercise over each standard
+// distance, ordered by exercise then distance.
+func BestEfforts(reps []Repetition) []BestEffort {
+	best := make(map[string]map[string]BestEffort)
+
+	for _, r := range reps {
+		meters := r.Meters()
+		elapsed := r.Duration()
+		if meters == 0 || elapsed == 0 {
+			continue
+		}
+		for _, distance := range StandardDistances {
+			if meters < distance.Meters {
+				continue
+			}
+			t := time.Duration(float64(elapsed) * distance.Meters / meters).Round(time.Second)
+			if best[r.Exercise] == nil {
+				best[r.Exercise] = make(map[string]BestEffort)
+			}
+			if previous, ok := best[r.Exercise][distance.Name]; !ok || t < previous.Time {
+				best[r.Exercise][distance.Name] = BestEffort{
+					Exercise:   r.Exercise,
+					Distance:   distance,
+					Time:       t,
+					Repetition: r,
+				}
+			}
+		}
+	}
+
+	exercises := make([]string, 0, len(best))
+	for exercise := range best {
+		exercises = append(exercises, exercise)
+	}
+	sort.Strings(exercises)
+
+	efforts := make([]BestEffort, 0)
+	for _, exercise := range exercises {
+		for _, distance := range StandardDistances {
+			if effort, ok := best[exercise][distance.Name]; ok {
+				efforts = append(efforts, effort)
+			}
+		}
+	}
+	return efforts
+}
+
+// WeekOf is the Monday starting the week containing the date.
+func WeekOf(date civil.Date) civil.Date {
+	weekday := time.Date(date.Year, date.Month, date.Day, 0, 0, 0, 0, time.UTC).Weekday()
+	return date.AddDays(-((int(weekday) + 6) % 7))
+}
+
+// WeeklyMileage totals the distance covered in a week.
+type WeeklyMileage struct {
+	Week     civil.Date
+	Units    string
+	Distance float64
+	// LongRun is the longest single repetition of the week.
+	LongRun float64
+	// LongRunShare is the fraction of the week's distance done in the long run.
+	LongRunShare float64
+	Count        int
+}
+
+// LongRunPercent is the long run share as a percentage.
+func (w WeeklyMileage) LongRunPercent() float64 {
+	return w.LongRunShare * 100
+}
+
+// WeeklyDistance totals the distance repetitions by week in the given units,
+// most recent week first.
+func WeeklyDistance(reps []Repetition, units string) []WeeklyMileage {
+	per, err := metersPer(units)
+	if err != nil {
+		return nil
+	}
+	weeks := make(map[civil.Date]*WeeklyMileage)
+
+	for _, r := range reps {
+		if !r.IsDistance() {
+			continue
+		}
+		week := WeekOf(r.SessionDate)
+		w, ok := weeks[week]
+		if !ok {
+			w = &WeeklyMileage{Week: week, Units: units}
+			weeks[week] = w
+		}
+		w.Distance += r.distanceIn(units)
+		w.Count++
+		w.LongRun = math.Max(w.LongRun, r.Meters()/per)
+	}
+
+	mileage := make([]WeeklyMileage, 0, len(weeks))
+	for _, w := range weeks {
+		if w.Distance > 0 {
+			w.LongRunShare = w.LongRun / w.Distance
+		}
+		mileage = append(mileage, *w)
+	}
+	sort.Slice(mileage, func(i, j int) bool {
+		return mileage[j].Week.Before(mileage[i].Week)
+	})
+	return mileage
+}
+
+// PacePoint is the pace of a repetition on a day, for charting trends.
+type PacePoint struct {
+	Date civil.Date
+	Pace Pace
+}
+
+// PaceTrend is the pace of each distance repetition of each exercise in date
+// order, keyed by exercise. Paces are per unit of the given units.
+func PaceTrend(reps []Repetition, units string) map[string][]PacePoint {
+	per, err := metersPer(units)
+	if err != nil {
+		return nil
+	}
+
+	trends := make(map[string][]PacePoint)
+	for _, r := range reps {
+		meters := r.Meters()
+		if meters == 0 || r.Duration() == 0 {
+			continue
+		}
+		pace := Pace(float64(r.Duration()) / (meters / per))
+		trends[r.Exercise] = append(trends[r.Exercise], PacePoint{Date: r.SessionDate, Pace: pace})
+	}
+
+	for _, points := range trends {
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].Date.Before(points[j].Date)
+		})
+	}
+	return trends
+}
+
+// E1RM estimates the most weight the repetition's exercise could be lifted
+// for a single rep, from its weight and volume, with Epley's formula. It is
+// zero for a distance, a failed set, or no weight.
+func (r Repetition) E1RM() float64 {
+	if r.IsDistance() || r.Failure || r.Weight <= 0 || r.Volume < 1 {
+		return 0
+	}
+	if r.Volume == 1 {
+		return float64(r.Weight)
+	}
+	return float64(r.Weight) * (1 + r.Volume/30)
+}
+
+// E1RMPoint is the best estimated one rep max of an exercise on a day, for
+// charting trends.
+type E1RMPoint struct {
+	Date  civil.Date
+	E1RM  float64
+	Units string
+}
+
+// E1RMTrend is the best estimated one rep max of each exercise on each day it
+// was done, in date order, keyed by exercise.
+func E1RMTrend(reps []Repetition) map[string][]E1RMPoint {
+	type day struct {
+		exercise string
+		date     civil.Date
+	}
+	best := make(map[day]E1RMPoint)
+	for _, r := range reps {
+		e1rm := r.E1RM()
+		if e1rm == 0 {
+			continue
+		}
+		key := day{r.Exercise, r.SessionDate}
+		if previous, ok := best[key]; ok && previous.E1RM >= e1rm {
+			continue
+		}
+		best[key] = E1RMPoint{Date: r.SessionDate, E1RM: e1rm, Units: r.Units}
+	}
+
+	trends := make(map[string][]E1RMPoint)
+	for key, point := range best {
+		trends[key.exercise] = append(trends[key.exercise], point)
+	}
+	for _, points := range trends {
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].Date.Before(points[j].Date)
+		})
+	}
+	return trends
+}
+
+// DistanceAnalytics is everything we compute about distance work.
+type DistanceAnalytics struct {
+	Exercise    string
+	Units       string
+	Weeks       []WeeklyMileage
+	BestEfforts []BestEffort
+	Trends      map[string][]PacePoint
+}
+
+// AnalyzeDistance computes the weekly distance, best efforts and pace trends
+// for the repetitions of exercise, or of everything if exercise is empty,
+// reporting distances and paces in units.
+func AnalyzeDistance(reps []Repetition, exercise, units string) (DistanceAnalytics, error) {
+	if _, err := metersPer(units); err != nil {
+		return DistanceAnalytics{}, err
+	}
+
+	if exercise != "" {
+		matching := make([]Repetition, 0, len(reps))
+		for _, r := range reps {
+			if r.Exercise == exercise {
+				matching = append(matching, r)
+			}
+		}
+		reps = matching
+	}
+
+	return DistanceAnalytics{
+		Exercise:    exercise,
+		Units:       units,
+		Weeks:       WeeklyDistance(reps, units),
+		BestEfforts: BestEfforts(reps),
+		Trends:      PaceTrend(reps, units),
+	}, nil
+}
@@ -0,0 +1,143 @@
+package lifting
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+func TestPace(t *testing.T) {
+	r := Repetition{
+		Exercise: "run",
+		Volume:   2,
+		Units:    "miles",
+		Elapsed:  civil.Time{Minute: 17},
+	}
+
+	if pace := r.Pace(); pace.String() != "8:30" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "8:30"), fmt.Sprintf("found %#v", pace.String()))
+	}
+
+	if speed := r.Speed(); speed < 7.05 || speed > 7.06 {
+		t.Fatal("unexpected speed", speed)
+	}
+
+	r.Units = "lbs"
+	if pace := r.Pace(); pace != 0 {
+		t.Fatal("pace for a non distance", pace)
+	}
+}
+
+func TestTonnage(t *testing.T) {
+	r := Repetition{Exercise: "squat", Weight: 225, Volume: 5, Units: "lbs", Sets: 3}
+	if tonnage := r.Tonnage(); tonnage != 1125 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 1125.0), fmt.Sprintf("found %#v", tonnage))
+	}
+
+	r = Repetition{Exercise: "ruck", Weight: 30, Volume: 4, Units: "miles"}
+	if tonnage := r.Tonnage(); tonnage != 0 {
+		t.Fatal("tonnage for a distance", tonnage)
+	}
+}
+
+func TestE1RMTrend(t *testing.T) {
+	monday := civil.Date{Year: 2018, Month: 12, Day: 17}
+	reps := []Repetition{
+		{Exercise: "squat", Weight: 280, Volume: 3, Units: "lbs", SessionDate: monday.AddDays(2)},
+		{Exercise: "squat", Weight: 225, Volume: 5, Units: "lbs", SessionDate: monday},
+		{Exercise: "squat", Weight: 270, Volume: 5, Units: "lbs", SessionDate: monday.AddDays(2)},
+		{Exercise: "squat", Weight: 350, Volume: 1, Units: "lbs", SessionDate: monday.AddDays(4), Failure: true},
+		{Exercise: "run", Volume: 3, Units: "miles", SessionDate: monday},
+	}
+
+	if e1rm := reps[1].E1RM(); e1rm != 262.5 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 262.5), fmt.Sprintf("found %#v", e1rm))
+	}
+
+	trends := E1RMTrend(reps)
+	expected := map[string][]E1RMPoint{
+		"squat": {
+			{Date: monday, E1RM: 262.5, Units: "lbs"},
+			{Date: monday.AddDays(2), E1RM: 315, Units: "lbs"},
+		},
+	}
+	if fmt.Sprint(trends) != fmt.Sprint(expected) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", expected), fmt.Sprintf("found %#v", trends))
+	}
+}
+
+func TestDistanceAnalytics(t *testing.T) {
+	reps := []Repetition{
+		Repetition{
+			Exercise:    "run",
+			Volume:      3.2,
+			Units:       "miles",
+			Elapsed:     civil.Time{Minute: 24},
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 17},
+		},
+		Repetition{
+			Exercise:    "run",
+			Volume:      10,
+			Units:       "km",
+			Elapsed:     civil.Time{Minute: 45},
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 23},
+		},
+		Repetition{
+			Exercise:    "run",
+			Volume:      1,
+			Units:       "miles",
+			Elapsed:     civil.Time{Minute: 6},
+			Sets:        2,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 24},
+		},
+		Repetition{
+			Exercise:    "squat",
+			Volume:      5,
+			Weight:      180,
+			Units:       "lbs",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 24},
+		},
+	}
+
+	analytics, err := AnalyzeDistance(reps, "run", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(analytics.Weeks) != 2 {
+		t.Fatal("expected two weeks", analytics.Weeks)
+	}
+
+	latest := analytics.Weeks[0]
+	if latest.Week != (civil.Date{Year: 2018, Month: 12, Day: 24}) || latest.Count != 1 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", latest))
+	}
+	if latest.Distance < 3.21 || latest.Distance > 3.22 {
+		t.Fatal("sets should count toward the weekly distance", latest.Distance)
+	}
+
+	earlier := analytics.Weeks[1]
+	if earlier.Distance < 15.14 || earlier.Distance > 15.15 || earlier.LongRun != 10 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", earlier))
+	}
+
+	bests := make(map[string]time.Duration)
+	for _, e := range analytics.BestEfforts {
+		bests[e.Distance.Name] = e.Time
+	}
+	if bests["mile"] != 6*time.Minute {
+		t.Fatal("unexpected best mile", bests["mile"])
+	}
+	if bests["10k"] != 45*time.Minute {
+		t.Fatal("unexpected best 10k", bests["10k"])
+	}
+	if _, ok := bests["half marathon"]; ok {
+		t.Fatal("nothing was long enough for a half marathon")
+	}
+
+	if trend := analytics.Trends["run"]; len(trend) != 3 || trend[0].Date.Day != 17 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", trend))
+	}
+}
@@ -1,18 +1,227 @@
 package lifting
 
 import (
+	"context"
+	"time"
+
 	"cloud.google.com/go/civil"
 )
 
 // Storage is an interface for the storage class
 type Storage interface {
+	// Ping checks the storage can be reached.
+	Ping() error
+	// Delete moves a repetition to the trash, where the Get methods and Search
+	// don't see it.
 	Delete(id int) error
+	// Restore takes a deleted repetition back out of the trash.
+	Restore(id int) error
+	// GetTrash lists what's in the trash, most recently deleted first.
+	GetTrash() ([]Trashed, error)
+	// CountTrash counts what's in the trash, without reading it.
+	CountTrash() (int, error)
+	// Purge permanently removes what was put in the trash by a time,
+	// returning how many repetitions went.
+	Purge(before time.Time) (int, error)
+	// GetChanges lists the changes made to a repetition, oldest first.
+	GetChanges(id int) ([]Change, error)
+	// ChangesSince lists the changes to any repetition after the one with the
+	// sequence number seq, oldest first and at most ChangeFeedPage of them.
+	// Start from zero and carry on from the ID of the last change.
+	ChangesSince(seq int) ([]Change, error)
+	// Load inserts or updates the repetitions, setting the ID of any that were
+	// newly inserted.
 	Load(repetitions []Repetition) error
-	GetLast(count, offset int) ([]Repetition, error)
+	// GetLast pages through the most recent repetitions, newest first. An
+	// empty cursor starts from the newest.
+	GetLast(count int, cursor string) (Result, error)
 	GetByID(id int) (*Repetition, error)
+	// GetByClientID finds the repetition stored with a ClientID, even if it's
+	// in the trash, so a client sending it again can tell it's already there.
+	GetByClientID(clientID string) (*Repetition, error)
 	GetBetween(start, end civil.Date) ([]Repetition, error)
+	// CountBetween counts the repetitions GetBetween would return, without
+	// reading them.
+	CountBetween(start, end civil.Date) (int, error)
 	GetUniqueCategories() ([]string, error)
 	GetByCategory(label string, count, offset int) ([]Repetition, error)
 	GetUniqueExercises() ([]string, error)
 	GetUniqueUnits() ([]string, error)
+	// Search finds the repetitions matching the query, a page at a time.
+	Search(q Query) (Result, error)
+	AttachTrack(track Track) error
+	// LoadWithTrack inserts a repetition and attaches its track all at once,
+	// setting the repetition's ID.
+	LoadWithTrack(repetition *Repetition, track Track) error
+	GetTrack(id int) (*Track, error)
+	// LoadMeasurements inserts or updates the measurements, setting the ID of
+	// any that were newly inserted.
+	LoadMeasurements(measurements []Measurement) error
+	GetMeasurements(kind string, start, end civil.Date) ([]Measurement, error)
+	DeleteMeasurement(id int) error
+	// LoadBackup loads a backup into empty storage all at once, ErrConflict
+	// if it isn't empty. Use RestoreBackup to read one.
+	LoadBackup(backup Backup) error
+}
+
+// ContextStorage is Storage with a context on every call, so a caller can put
+// a deadline on a query or cancel it, e.g. when the client goes away. The
+// backends implement this; use Adapt where there's no context to pass.
+//
+// Asking for, updating or deleting an ID that isn't stored, or is in the
+// trash, gives ErrNotFound, as does restoring one that isn't in the trash.
+// Storing a repetition that can't be stored gives an *InvalidRepetitionError,
+// with the Index of which one it was, and clashing with what's already stored, like inserting a ClientID that's
+// already used, gives ErrConflict.
+//
+// Every insert, update, delete and restore of a repetition is recorded as a
+// Change, made by the actor in the context, see WithActor.
+type ContextStorage interface {
+	Ping(ctx context.Context) error
+	Delete(ctx context.Context, id int) error
+	Restore(ctx context.Context, id int) error
+	GetTrash(ctx context.Context) ([]Trashed, error)
+	CountTrash(ctx context.Context) (int, error)
+	Purge(ctx context.Context, before time.Time) (int, error)
+	GetChanges(ctx context.Context, id int) ([]Change, error)
+	ChangesSince(ctx context.Context, seq int) ([]Change, error)
+	Load(ctx context.Context, repetitions []Repetition) error
+	GetLast(ctx context.Context, count int, cursor string) (Result, error)
+	GetByID(ctx context.Context, id int) (*Repetition, error)
+	GetByClientID(ctx context.Context, clientID string) (*Repetition, error)
+	GetBetween(ctx context.Context, start, end civil.Date) ([]Repetition, error)
+	CountBetween(ctx context.Context, start, end civil.Date) (int, error)
+	GetUniqueCategories(ctx context.Context) ([]string, error)
+	GetByCategory(ctx context.Context, label string, count, offset int) ([]Repetition, error)
+	GetUniqueExercises(ctx context.Context) ([]string, error)
+	GetUniqueUnits(ctx context.Context) ([]string, error)
+	Search(ctx context.Context, q Query) (Result, error)
+	AttachTrack(ctx context.Context, track Track) error
+	LoadWithTrack(ctx context.Context, repetition *Repetition, track Track) error
+	GetTrack(ctx context.Context, id int) (*Track, error)
+	LoadMeasurements(ctx context.Context, measurements []Measurement) error
+	GetMeasurements(ctx context.Context, kind string, start, end civil.Date) ([]Measurement, error)
+	DeleteMeasurement(ctx context.Context, id int) error
+	LoadBackup(ctx context.Context, backup Backup) error
+}
+
+// Adapt makes a ContextStorage into a Storage for callers that don't have a
+// context, running everything with context.Background().
+func Adapt(s ContextStorage) Storage {
+	return AdaptWith(context.Background(), s)
+}
+
+// AdaptWith is Adapt running everything with ctx instead, e.g. to say who is
+// making changes.
+func AdaptWith(ctx context.Context, s ContextStorage) Storage {
+	return adapter{ctx, s}
+}
+
+type adapter struct {
+	ctx context.Context
+	s   ContextStorage
+}
+
+func (a adapter) Ping() error {
+	return a.s.Ping(a.ctx)
+}
+
+func (a adapter) Delete(id int) error {
+	return a.s.Delete(a.ctx, id)
+}
+
+func (a adapter) Restore(id int) error {
+	return a.s.Restore(a.ctx, id)
+}
+
+func (a adapter) GetTrash() ([]Trashed, error) {
+	return a.s.GetTrash(a.ctx)
+}
+
+func (a adapter) CountTrash() (int, error) {
+	return a.s.CountTrash(a.ctx)
+}
+
+func (a adapter) Purge(before time.Time) (int, error) {
+	return a.s.Purge(a.ctx, before)
+}
+
+func (a adapter) GetChanges(id int) ([]Change, error) {
+	return a.s.GetChanges(a.ctx, id)
+}
+
+func (a adapter) ChangesSince(seq int) ([]Change, error) {
+	return a.s.ChangesSince(a.ctx, seq)
+}
+
+func (a adapter) Load(repetitions []Repetition) error {
+	return a.s.Load(a.ctx, repetitions)
+}
+
+func (a adapter) GetLast(count int, cursor string) (Result, error) {
+	return a.s.GetLast(a.ctx, count, cursor)
+}
+
+func (a adapter) GetByID(id int) (*Repetition, error) {
+	return a.s.GetByID(a.ctx, id)
+}
+
+func (a adapter) GetByClientID(clientID string) (*Repetition, error) {
+	return a.s.GetByClientID(a.ctx, clientID)
+}
+
+func (a adapter) GetBetween(start, end civil.Date) ([]Repetition, error) {
+	return a.s.GetBetween(a.ctx, start, end)
+}
+
+func (a adapter) CountBetween(start, end civil.Date) (int, error) {
+	return a.s.CountBetween(a.ctx, start, end)
+}
+
+func (a adapter) GetUniqueCategories() ([]string, error) {
+	return a.s.GetUniqueCategories(a.ctx)
+}
+
+func (a adapter) GetByCategory(label string, count, offset int) ([]Repetition, error) {
+	return a.s.GetByCategory(a.ctx, label, count, offset)
+}
+
+func (a adapter) GetUniqueExercises() ([]string, error) {
+	return a.s.GetUniqueExercises(a.ctx)
+}
+
+func (a adapter) GetUniqueUnits() ([]string, error) {
+	return a.s.GetUniqueUnits(a.ctx)
+}
+
+func (a adapter) Search(q Query) (Result, error) {
+	return a.s.Search(a.ctx, q)
+}
+
+func (a adapter) AttachTrack(track Track) error {
+	return a.s.AttachTrack(a.ctx, track)
+}
+
+func (a adapter) LoadWithTrack(repetition *Repetition, track Track) error {
+	return a.s.LoadWithTrack(a.ctx, repetition, track)
+}
+
+func (a adapter) GetTrack(id int) (*Track, error) {
+	return a.s.GetTrack(a.ctx, id)
+}
+
+func (a adapter) LoadMeasurements(measurements []Measurement) error {
+	return a.s.LoadMeasurements(a.ctx, measurements)
+}
+
+func (a adapter) GetMeasurements(kind string, start, end civil.Date) ([]Measurement, error) {
+	return a.s.GetMeasurements(a.ctx, kind, start, end)
+}
+
+func (a adapter) DeleteMeasurement(id int) error {
+	return a.s.DeleteMeasurement(a.ctx, id)
+}
+
+func (a adapter) LoadBackup(backup Backup) error {
+	return a.s.LoadBackup(a.ctx, backup)
 }
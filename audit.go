@@ -0,0 +1,242 @@
+package lifting
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Action is the kind of change made to a repetition.
+type Action string
+
+// The changes the backends record.
+const (
+	Inserted Action = "insert"
+	Updated  Action = "update"
+	Deleted  Action = "delete"
+	Restored Action = "restore"
+)
+
+type (
+	// Change is a record of something done to a repetition, with how it was
+	// before and after. Before is nil for an insert or restore and After is
+	// nil for a delete, as the repetition wasn't there. IDs only go up, so
+	// they're the sequence numbers of the change feed, see ChangesSince.
+	Change struct {
+		ID           int
+		RepetitionID int
+		Action       Action
+		// Actor is who made the change, see WithActor.
+		Actor  string
+		At     time.Time
+		Before *Repetition
+		After  *Repetition
+	}
+
+	// ChangeRow is the SQL database format for a Change, with the
+	// repetitions as JSON.
+	ChangeRow struct {
+		ID           int
+		RepetitionID int `db:"workout_id"`
+		Action       string
+		Actor        sql.NullString
+		At           time.Time      `db:"changed_at"`
+		Before       sql.NullString `db:"before_version"`
+		After        sql.NullString `db:"after_version"`
+	}
+
+	// FieldChange is how one field of a repetition was changed.
+	FieldChange struct {
+		Field, Before, After string
+	}
+)
+
+type actorKey struct{}
+
+// WithActor says who is making the changes made with the context, for the
+// change log.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom is who WithActor said is making changes, empty if nobody.
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+func snapshot(r *Repetition) (sql.NullString, error) {
+	if r == nil {
+		return sql.NullString{}, nil
+	}
+	// when and in what order it changed is the change's business, not part
+	// of the version.
+	version := *r
+	version.CreatedAt, version.UpdatedAt, version.Seq = time.Time{}, time.Time{}, 0
+	data, err := json.Marshal(version)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func unsnapshot(s sql.NullString) (*Repetition, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	var r Repetition
+	if err := json.Unmarshal([]byte(s.String), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// NewChangeRow records a change to the repetition with the ID for the
+// database, made now by the actor in the context.
+func NewChangeRow(ctx context.Context, id int, action Action, before, after *Repetition) (ChangeRow, error) {
+	row := ChangeRow{
+		RepetitionID: id,
+		Action:       string(action),
+		Actor:        nullString(ActorFrom(ctx)),
+		At:           time.Now().UTC(),
+	}
+	var err error
+	if row.Before, err = snapshot(before); err != nil {
+		return row, err
+	}
+	if row.After, err = snapshot(after); err != nil {
+		return row, err
+	}
+	return row, nil
+}
+
+// RowToChange transforms from a database row to a change.
+func RowToChange(row ChangeRow) (Change, error) {
+	change := Change{
+		ID:           row.ID,
+		RepetitionID: row.RepetitionID,
+		Action:       Action(row.Action),
+		Actor:        row.Actor.String,
+		At:           row.At,
+	}
+	var err error
+	if change.Before, err = unsnapshot(row.Before); err != nil {
+		return change, fmt.Errorf("change %d: %v", row.ID, err)
+	}
+	if change.After, err = unsnapshot(row.After); err != nil {
+		return change, fmt.Errorf("change %d: %v", row.ID, err)
+	}
+	return change, nil
+}
+
+// RowsToChanges transforms from database rows to changes.
+func RowsToChanges(rows []ChangeRow) ([]Change, error) {
+	changes := make([]Change, len(rows))
+	for i, row := range rows {
+		change, err := RowToChange(row)
+		if err != nil {
+			return nil, err
+		}
+		changes[i] = change
+	}
+	return changes, nil
+}
+
+// Stamp marks a repetition as last changed at a time by the change with the
+// sequence number seq, and as created then if it wasn't already. It does
+// nothing to a nil repetition.
+func Stamp(r *Repetition, seq int, at time.Time) {
+	if r == nil {
+		return
+	}
+	r.Seq, r.UpdatedAt = seq, at
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = at
+	}
+}
+
+// Diff lists the fields an update changed, in alphabetical order. It's empty
+// for anything but an update.
+func (c Change) Diff() ([]FieldChange, error) {
+	if c.Before == nil || c.After == nil {
+		return nil, nil
+	}
+	before, err := fields(c.Before)
+	if err != nil {
+		return nil, fmt.Errorf("change %d: %v", c.ID, err)
+	}
+	after, err := fields(c.After)
+	if err != nil {
+		return nil, fmt.Errorf("change %d: %v", c.ID, err)
+	}
+
+	diff := make([]FieldChange, 0)
+	for field, value := range after {
+		was, is := fmt.Sprint(before[field]), fmt.Sprint(value)
+		if was != is {
+			diff = append(diff, FieldChange{Field: field, Before: was, After: is})
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Field < diff[j].Field })
+	return diff, nil
+}
+
+// fields is the repetition's fields by name, as they're stored in a change.
+func fields(r *Repetition) (map[string]interface{}, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Revert puts the repetition back how it was after one of its changes,
+// restoring it from the trash or deleting it as needed. The revert is recorded
+// as changes of its own.
+func Revert(ctx context.Context, s ContextStorage, id, changeID int) error {
+	changes, err := s.GetChanges(ctx, id)
+	if err != nil {
+		return err
+	}
+	var target *Change
+	for i := range changes {
+		if changes[i].ID == changeID {
+			target = &changes[i]
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("change %d to repetition %d: %w", changeID, id, ErrNotFound)
+	}
+
+	_, err = s.GetByID(ctx, id)
+	trashed := errors.Is(err, ErrNotFound)
+	if err != nil && !trashed {
+		return err
+	}
+
+	if target.After == nil {
+		if trashed {
+			return nil
+		}
+		return s.Delete(ctx, id)
+	}
+	if trashed {
+		if err = s.Restore(ctx, id); err != nil {
+			return err
+		}
+	}
+	version := *target.After
+	version.ID = &id
+	return s.Load(ctx, []Repetition{version})
+}
+
+// ChangeFeedPage is the most changes ChangesSince returns at once.
+const ChangeFeedPage = 500
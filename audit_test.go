@@ -0,0 +1,56 @@
+package lifting
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/civil"
+)
+
+func TestChangeRow(t *testing.T) {
+	id := 3
+	before := Repetition{
+		ID:          &id,
+		Exercise:    "run",
+		Volume:      2,
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+		Elapsed:     civil.Time{Minute: 20},
+		Units:       "miles",
+	}
+	after := before
+	after.Volume = 3
+	after.Comment = "windy"
+
+	row, err := NewChangeRow(WithActor(context.Background(), "tester"), id, Updated, &before, &after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := RowToChange(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Actor != "tester" || change.Action != Updated || change.RepetitionID != id {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", change))
+	}
+	if change.Before.Elapsed != before.Elapsed || change.After.SessionDate != after.SessionDate {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", after), fmt.Sprintf("found %#v", change.After))
+	}
+
+	expected := []FieldChange{{"Comment", "", "windy"}, {"Volume", "2", "3"}}
+	diff, err := change.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(diff) != fmt.Sprint(expected) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", expected), fmt.Sprintf("found %#v", diff))
+	}
+
+	inserted, err := RowToChange(ChangeRow{Action: string(Inserted), After: row.After})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff, err = inserted.Diff(); inserted.Before != nil || diff != nil || err != nil {
+		t.Fatal("expected nothing before an insert", inserted)
+	}
+}
@@ -0,0 +1,331 @@
+package lifting
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+// BackupVersion is the version of the backup format written. Restoring reads
+// this version or older.
+const BackupVersion = 1
+
+// The files in a backup, each JSON Lines, one record per line.
+const (
+	manifestFile     = "manifest.json"
+	repetitionsFile  = "repetitions.jsonl"
+	tracksFile       = "tracks.jsonl"
+	measurementsFile = "measurements.jsonl"
+)
+
+type (
+	// Manifest describes what's in a backup, so it can be checked before
+	// anything is restored.
+	Manifest struct {
+		Version   int
+		CreatedAt time.Time
+		Files     []ManifestFile
+	}
+
+	// ManifestFile is a file in a backup, with how many records it holds and
+	// the hex SHA-256 of its contents.
+	ManifestFile struct {
+		Name    string
+		Records int
+		SHA256  string
+	}
+
+	// BackupRepetition is a line of the repetitions file: a repetition, with
+	// when it was deleted if it's in the trash.
+	BackupRepetition struct {
+		Repetition
+		DeletedAt *time.Time `json:",omitempty"`
+	}
+
+	// Backup is what's read out of a backup, for a backend to load in one
+	// go, see ContextStorage.LoadBackup. The tracks refer to the repetitions
+	// by their IDs in the backup.
+	Backup struct {
+		Repetitions  []BackupRepetition
+		Tracks       []Track
+		Measurements []Measurement
+	}
+)
+
+// Records is how many records of a file the manifest lists, zero if it's not
+// in the backup.
+func (m Manifest) Records(name string) int {
+	for _, f := range m.Files {
+		if f.Name == name {
+			return f.Records
+		}
+	}
+	return 0
+}
+
+// jsonLines collects records into a file of a backup.
+type jsonLines struct {
+	name    string
+	buf     bytes.Buffer
+	records int
+}
+
+func (l *jsonLines) add(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	l.buf.Write(data)
+	l.buf.WriteByte('\n')
+	l.records++
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// allRepetitions pages through every repetition that isn't in the trash,
+// oldest first.
+func allRepetitions(ctx context.Context, s ContextStorage) ([]Repetition, error) {
+	reps := make([]Repetition, 0)
+	q := Query{Sort: Oldest, Count: DefaultPageSize}
+	for {
+		result, err := s.Search(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		reps = append(reps, result.Repetitions...)
+		if result.Next == "" {
+			return reps, nil
+		}
+		q.Cursor = result.Next
+	}
+}
+
+// WriteBackup writes everything in the storage, including the trash, to w as
+// a gzipped tar of JSON Lines files with a manifest. The change log isn't
+// kept, so restoring starts a new one.
+func WriteBackup(ctx context.Context, s ContextStorage, w io.Writer) (Manifest, error) {
+	manifest := Manifest{Version: BackupVersion, CreatedAt: time.Now().UTC()}
+
+	reps, err := allRepetitions(ctx, s)
+	if err != nil {
+		return manifest, err
+	}
+	trashed, err := s.GetTrash(ctx)
+	if err != nil {
+		return manifest, err
+	}
+	measurements, err := s.GetMeasurements(ctx, "", civil.Date{Year: 1, Month: 1, Day: 1}, civil.Date{Year: 9999, Month: 12, Day: 31})
+	if err != nil {
+		return manifest, err
+	}
+
+	repetitions := &jsonLines{name: repetitionsFile}
+	tracks := &jsonLines{name: tracksFile}
+	ms := &jsonLines{name: measurementsFile}
+
+	all := make([]BackupRepetition, 0, len(reps)+len(trashed))
+	for _, r := range reps {
+		all = append(all, BackupRepetition{Repetition: r})
+	}
+	for i := range trashed {
+		all = append(all, BackupRepetition{Repetition: trashed[i].Repetition, DeletedAt: &trashed[i].DeletedAt})
+	}
+	for _, r := range all {
+		if err = repetitions.add(r); err != nil {
+			return manifest, err
+		}
+		track, err := s.GetTrack(ctx, *r.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return manifest, err
+		}
+		if err = tracks.add(track); err != nil {
+			return manifest, err
+		}
+	}
+	for _, m := range measurements {
+		if err = ms.add(m); err != nil {
+			return manifest, err
+		}
+	}
+
+	files := []*jsonLines{repetitions, tracks, ms}
+	for _, f := range files {
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:    f.name,
+			Records: f.records,
+			SHA256:  checksum(f.buf.Bytes()),
+		})
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	write := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := archive.Write(data)
+		return err
+	}
+	if err = write(manifestFile, manifestData); err != nil {
+		return manifest, err
+	}
+	for _, f := range files {
+		if err = write(f.name, f.buf.Bytes()); err != nil {
+			return manifest, err
+		}
+	}
+	if err = archive.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, gz.Close()
+}
+
+// readBackup reads the files out of a backup, checking them against its
+// manifest.
+func readBackup(r io.Reader) (Manifest, map[string][]byte, error) {
+	var manifest Manifest
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	archive := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		if files[header.Name], err = ioutil.ReadAll(archive); err != nil {
+			return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+	}
+
+	data, ok := files[manifestFile]
+	if !ok {
+		return manifest, nil, fmt.Errorf("%w: no %s", ErrInvalidBackup, manifestFile)
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return manifest, nil, fmt.Errorf("%w: %s: %v", ErrInvalidBackup, manifestFile, err)
+	}
+	if manifest.Version < 1 || manifest.Version > BackupVersion {
+		return manifest, nil, fmt.Errorf("%w: version %d, expected %d or older", ErrInvalidBackup, manifest.Version, BackupVersion)
+	}
+	for _, f := range manifest.Files {
+		data, ok := files[f.Name]
+		if !ok {
+			return manifest, nil, fmt.Errorf("%w: %s is missing", ErrInvalidBackup, f.Name)
+		}
+		if checksum(data) != f.SHA256 {
+			return manifest, nil, fmt.Errorf("%w: %s doesn't match its checksum", ErrInvalidBackup, f.Name)
+		}
+	}
+	return manifest, files, nil
+}
+
+// eachLine decodes each line of a JSON Lines file, counting them.
+func eachLine(name string, data []byte, decode func(line []byte) error) (int, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if err := decode(scanner.Bytes()); err != nil {
+			return n, fmt.Errorf("%w: %s line %d: %v", ErrInvalidBackup, name, n, err)
+		}
+	}
+	return n, scanner.Err()
+}
+
+// RestoreBackup loads a backup written by WriteBackup into empty storage,
+// ErrConflict if it isn't empty. Everything is checked against the manifest
+// before anything is loaded, and then it's loaded in one transaction, so a
+// restore that fails leaves the storage empty to try again. Repetitions get
+// new IDs, and what was in the trash goes back in it.
+func RestoreBackup(ctx context.Context, s ContextStorage, r io.Reader) (Manifest, error) {
+	manifest, files, err := readBackup(r)
+	if err != nil {
+		return manifest, err
+	}
+
+	var backup Backup
+	counts := map[string]int{}
+	counts[repetitionsFile], err = eachLine(repetitionsFile, files[repetitionsFile], func(line []byte) error {
+		var r BackupRepetition
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		backup.Repetitions = append(backup.Repetitions, r)
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+	counts[tracksFile], err = eachLine(tracksFile, files[tracksFile], func(line []byte) error {
+		var t Track
+		if err := json.Unmarshal(line, &t); err != nil {
+			return err
+		}
+		backup.Tracks = append(backup.Tracks, t)
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+	counts[measurementsFile], err = eachLine(measurementsFile, files[measurementsFile], func(line []byte) error {
+		var m Measurement
+		if err := json.Unmarshal(line, &m); err != nil {
+			return err
+		}
+		backup.Measurements = append(backup.Measurements, m)
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+	for name, n := range counts {
+		if n != manifest.Records(name) {
+			return manifest, fmt.Errorf("%w: %s has %d records, the manifest says %d", ErrInvalidBackup, name, n, manifest.Records(name))
+		}
+	}
+
+	backedUp := make(map[int]bool, len(backup.Repetitions))
+	for _, r := range backup.Repetitions {
+		if r.ID != nil {
+			backedUp[*r.ID] = true
+		}
+	}
+	for _, t := range backup.Tracks {
+		if !backedUp[t.RepetitionID] {
+			return manifest, fmt.Errorf("%w: track for repetition %d, which isn't in the backup", ErrInvalidBackup, t.RepetitionID)
+		}
+	}
+	return manifest, s.LoadBackup(ctx, backup)
+}
@@ -0,0 +1,63 @@
+package lifting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The errors storage backends return, check for them with errors.Is.
+var (
+	// ErrNotFound means there's nothing with the ID asked for.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the change clashes with what's already stored.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidRepetition means a repetition can't be stored as it is, the
+	// error will be an *InvalidRepetitionError saying why.
+	ErrInvalidRepetition = errors.New("invalid repetition")
+	// ErrInvalidQuery means a search couldn't be understood, e.g. a mangled
+	// cursor.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrInvalidBackup means a backup is damaged, or from a newer version.
+	ErrInvalidBackup = errors.New("invalid backup")
+)
+
+// InvalidRepetitionError lists what's wrong with a repetition.
+type InvalidRepetitionError struct {
+	Repetition Repetition
+	// Index is where the repetition was in the ones loaded together, so a
+	// form of several can say which it was.
+	Index int
+	// Fields maps the name of each bad field to what's wrong with it.
+	Fields map[string]string
+}
+
+// InvalidAt sets the Index of err, if it's an *InvalidRepetitionError, to i,
+// returning err.
+func InvalidAt(err error, i int) error {
+	var invalid *InvalidRepetitionError
+	if errors.As(err, &invalid) {
+		invalid.Index = i
+	}
+	return err
+}
+
+func (e *InvalidRepetitionError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	problems := make([]string, len(fields))
+	for i, field := range fields {
+		problems[i] = fmt.Sprintf("%s %s", field, e.Fields[field])
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidRepetition, strings.Join(problems, ", "))
+}
+
+// Is makes errors.Is(err, ErrInvalidRepetition) true.
+func (e *InvalidRepetitionError) Is(target error) bool {
+	return target == ErrInvalidRepetition
+}
@@ -1,12 +1,22 @@
 package lifting
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
-	"log"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
-	"regexp"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
 	"time"
 
@@ -17,66 +27,59 @@ func now() string {
 	return civil.DateOf(time.Now()).String()
 }
 
-// Page defines pagination.
+// Page defines pagination: how many rows to show, starting from a cursor
+// handed out with a previous page.
 type Page struct {
-	Offset int
+	Cursor string
 	Count  int
 }
 
-// Next returns the query for the next page of results
-func (p *Page) Next() Page {
-	return Page{
-		Offset: p.Offset + p.Count,
-		Count:  p.Count,
-	}
-}
-
-// Previous returns the query for the previous page of results
-func (p *Page) Previous() Page {
-	offset := p.Offset - p.Count
-	if offset < 0 {
-		offset = 0
-	}
-	return Page{
-		Offset: offset,
-		Count:  p.Count,
-	}
-}
-
 // Context is basic context for the site.
 type Context struct {
-	History      []Repetition
-	Group        []Group
-	Categories   []string
-	Exercises    []string
-	Units        []string
-	Repetition   *Repetition
-	Now          string
-	Message      string
-	Next         Page
-	Previous     Page
+	History    []Repetition
+	Group      []Group
+	Categories []string
+	Exercises  []string
+	Units      []string
+	Repetition *Repetition
+	Now        string
+	Message    string
+	// Next and Previous are the cursors for the earlier and later pages.
+	Next         string
+	Previous     string
 	Current      Page
 	CanGoLater   bool
 	CanGoEarlier bool
+	// Errors maps the fields of a submitted repetition to what's wrong with
+	// them.
+	Errors map[string]string
+	// Undo is the token to take back the change described by Message.
+	Undo string
 }
 
-func (h *Handlers) getContext(page Page) (*Context, error) {
-	reps, err := h.Storage.GetLast(page.Count, page.Offset)
+func (h *Handlers) getContext(ctx context.Context, page Page) (*Context, error) {
+	result, err := h.Storage.GetLast(ctx, page.Count, page.Cursor)
 	if err != nil {
 		return nil, err
 	}
+	return h.newContext(ctx, result, page)
+}
 
-	categories, err := h.Storage.GetUniqueCategories()
+// newContext fills in the context around a page of results.
+func (h *Handlers) newContext(ctx context.Context, result Result, page Page) (*Context, error) {
+	reps := result.Repetitions
+
+	categories, err := h.Storage.GetUniqueCategories(ctx)
 
 	if err != nil {
 		return nil, err
 	}
-	exercises, err := h.Storage.GetUniqueExercises()
+	exercises, err := h.Storage.GetUniqueExercises(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	units, err := h.Storage.GetUniqueUnits()
+	units, err := h.Storage.GetUniqueUnits(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -87,24 +90,20 @@ func (h *Handlers) getContext(page Page) (*Context, error) {
 
 	return &Context{
 		History:      reps,
-		Group:        group(reps),
+		Group:        GroupByDate(reps),
 		Categories:   categories,
 		Exercises:    exercises,
 		Repetition:   nil,
 		Now:          now(),
 		Units:        units,
-		Next:         page.Next(),
-		Previous:     page.Previous(),
+		Next:         result.Next,
+		Previous:     result.Previous,
 		Current:      page,
-		CanGoLater:   page.Offset > 0,
-		CanGoEarlier: len(reps) == page.Count,
+		CanGoLater:   result.Previous != "",
+		CanGoEarlier: result.Next != "",
 	}, nil
 }
 
-var edit = regexp.MustCompile(`/edit/(?P<ID>\d\d*)(/)?`)
-var copy = regexp.MustCompile(`/copy/(?P<ID>\d\d*)(/)?`)
-var delete = regexp.MustCompile(`/delete/(?P<ID>\d\d*)(/)?`)
-
 const (
 	category    = "Category"
 	sessionDate = "SessionDate"
@@ -120,72 +119,212 @@ const (
 	comment     = "Comment"
 	id          = "ID"
 	units       = "Units"
+	trackFile   = "Track"
+	undo        = "undo"
+	change      = "change"
 )
 
+// maxTrackSize is the largest activity file we'll accept for import.
+const maxTrackSize = 32 << 20
+
 // Handlers is all the http handlers
 type Handlers struct {
-	Storage Storage
+	Storage ContextStorage
 	Step    int
+	// Timeout is how long a request gets before its storage calls are
+	// cancelled, no limit if zero.
+	Timeout time.Duration
+	// Retention is how long deleted repetitions are kept in the trash,
+	// DefaultRetention if zero.
+	Retention time.Duration
+	// PollInterval is how often the change feed checks for new changes, a
+	// second if zero.
+	PollInterval time.Duration
+	// Templates are the pages, the ones built in if nil.
+	Templates *Templates
+	// Done is closed when the server is shutting down, to end the change
+	// feed streams that would otherwise keep it waiting.
+	Done <-chan struct{}
+	// Middleware runs around every request, inside the request ID, access
+	// log and panic recovery, the first outermost, e.g. to check who sent
+	// them.
+	Middleware []Middleware
+	// Logger gets the access log and the errors, slog.Default() if nil.
+	Logger *slog.Logger
+	// Metrics counts the requests, served at /metrics. Instrument the
+	// Storage with it to time the storage calls too.
+	Metrics *Metrics
+
+	routesOnce sync.Once
+	router     *Router
+}
+
+var (
+	builtIn     *Templates
+	builtInErr  error
+	loadBuiltIn sync.Once
+)
+
+// templates are the pages to render.
+func (h *Handlers) templates() (*Templates, error) {
+	if h.Templates != nil {
+		return h.Templates, nil
+	}
+	loadBuiltIn.Do(func() { builtIn, builtInErr = LoadTemplates(TemplateFS(), false) })
+	return builtIn, builtInErr
 }
 
 // Handle is the root handler
 func (h *Handlers) Handle(w http.ResponseWriter, r *http.Request) {
+	h.routesOnce.Do(func() { h.router = h.routes() })
 	w.Header().Add("Content-Type", "Text/HTML")
-	path := r.URL.Path
+	h.router.ServeHTTP(w, r)
+}
 
-	switch {
-	case path == "/" || path == "":
-		h.index(w, r)
-	case (path == "/create/" || path == "/create"):
-		h.handleCreate(w, r)
-	case edit.MatchString(path):
-		h.handleEdit(w, r)
-	case copy.MatchString(path):
-		h.handleCopy(w, r)
-	case delete.MatchString(path):
-		h.handleDelete(w, r)
-	default:
-		var templates = template.Must(template.ParseFiles("templates/404.html", "templates/base.html"))
-		err := templates.ExecuteTemplate(w, "404.html", Context{})
-		if err != nil {
-			h.handleErrors(w, r, err, http.StatusInternalServerError)
-			return
+// routes are where each page is, with the middleware every request goes
+// through.
+func (h *Handlers) routes() *Router {
+	router := &Router{NotFound: http.HandlerFunc(h.notFound)}
+	router.Use(withRequestID, h.accessLog, h.recovery)
+	router.Use(h.Middleware...)
+	router.Use(h.withTimeout, withActor)
+
+	router.HandleFunc("GET", "/", h.index)
+	router.HandleFunc("GET", "/create", h.handleCreateGet)
+	router.HandleFunc("POST", "/create", h.handleCreate)
+	router.HandleFunc("GET", "/session", h.handleSession)
+	router.HandleFunc("POST", "/session", h.handleSessionPost)
+	router.HandleFunc("GET", "/edit/{id}", h.handleEdit)
+	router.HandleFunc("POST", "/edit/{id}", h.handleEdit)
+	router.HandleFunc("GET", "/copy/{id}", h.handleCopy)
+	router.HandleFunc("POST", "/copy/{id}", h.handleCopy)
+	router.HandleFunc("GET", "/delete/{id}", h.handleDelete)
+	router.HandleFunc("POST", "/delete/{id}", h.handleDelete)
+	router.HandleFunc("GET", "/import", h.handleImport)
+	router.HandleFunc("POST", "/import", h.handleImportPost)
+	router.HandleFunc("GET", "/track/{id}", h.handleTrack)
+	router.HandleFunc("GET", "/analytics", h.handleAnalytics)
+	router.HandleFunc("GET", "/api/analytics/distance", h.handleDistanceAPI)
+	router.HandleFunc("GET", "/api/analytics/strength", h.handleStrengthAPI)
+	router.HandleFunc("GET", "/measurements", h.handleMeasurementsGet)
+	router.HandleFunc("POST", "/measurements", h.handleMeasurementsPost)
+	router.HandleFunc("GET", "/scores", h.handleScores)
+	router.HandleFunc("GET", "/search", h.handleSearch)
+	router.HandleFunc("GET", "/trash", h.handleTrash)
+	router.HandleFunc("POST", "/trash", h.handleTrash)
+	router.HandleFunc("POST", "/restore/{id}", h.handleRestore)
+	router.HandleFunc("POST", "/undo", h.handleUndo)
+	router.HandleFunc("GET", "/history/{id}", h.handleHistory)
+	router.HandleFunc("POST", "/history/{id}", h.handleRevert)
+	router.HandleFunc("GET", "/api/changes", h.handleChangeFeed)
+	router.HandleFunc("POST", "/api/repetitions", h.handleCreateAPI)
+	router.HandleFunc("GET", "/healthz", h.handleHealthz)
+	router.HandleFunc("GET", "/readyz", h.handleReadyz)
+	router.HandleFunc("GET", "/metrics", h.handleMetrics)
+	return router
+}
+
+func (h *Handlers) notFound(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotFound)
+	h.contextHandler(w, r, Context{}, "404.html")
+}
+
+// withTimeout cancels a request's storage calls after the Timeout. A stream
+// runs until the client goes, its polls get the timeout.
+func (h *Handlers) withTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.Timeout > 0 && !streaming(r) {
+			ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
 		}
-		break
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withActor records changes made by a request as made by where it came from.
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithActor(r.Context(), actor(r))))
+	})
+}
+
+// actor is who the change log says made changes from the web, the address
+// they came from as we don't have accounts.
+func actor(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return fmt.Sprintf("web (%s)", host)
+}
 
+// pathID is the {id} in the path, ErrNotFound if it isn't a number.
+func pathID(r *http.Request) (int, error) {
+	ID, err := strconv.Atoi(Param(r, "id"))
+	if err != nil {
+		return 0, fmt.Errorf("repetition %q: %w", Param(r, "id"), ErrNotFound)
 	}
+	return ID, nil
 }
 
-func (h *Handlers) getRep(id string) (*Repetition, error) {
-	ID, err := strconv.Atoi(id)
+// getRep is the repetition with the {id} in the path.
+func (h *Handlers) getRep(r *http.Request) (*Repetition, error) {
+	ID, err := pathID(r)
 	if err != nil {
 		return nil, err
 	}
-	repetition, err := h.Storage.GetByID(int(ID))
+	repetition, err := h.Storage.GetByID(r.Context(), ID)
 	if err != nil {
 		return nil, err
 	}
 	return repetition, nil
 }
 
+// statusFor picks the response code for an error: the one that fits if it's
+// one of the storage errors, otherwise the fallback.
+func statusFor(err error, fallback int) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidRepetition), errors.Is(err, ErrInvalidQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return fallback
+}
+
 func (h *Handlers) handleErrors(w http.ResponseWriter, r *http.Request, err error, code int) {
-	http.Error(w, err.Error(), code)
-	return
+	if code < http.StatusInternalServerError {
+		http.Error(w, err.Error(), code)
+		return
+	}
 
+	// the server's problem, so it's logged for whoever runs it.
+	h.logger().LogAttrs(r.Context(), slog.LevelError, "request failed",
+		slog.String("request_id", RequestID(r.Context())),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", code),
+		slog.String("error", err.Error()),
+	)
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Error(w, fmt.Sprintf("%v (request %s)", err, RequestID(r.Context())), code)
+		return
+	}
+	h.errorPage(w, r, err.Error(), code)
 }
 
 func (h *Handlers) contextHandler(w http.ResponseWriter, r *http.Request, context interface{}, t string) {
-	templates, err := template.ParseFiles(
-		fmt.Sprintf("templates/%s", t),
-		"templates/by-date-and-category.html",
-		"templates/base.html",
-	)
-
+	templates, err := h.templates()
 	if err != nil {
 		h.handleErrors(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	err = templates.ExecuteTemplate(w, t, context)
+	err = templates.Execute(w, t, context)
 
 	if err != nil {
 		h.handleErrors(w, r, err, http.StatusInternalServerError)
@@ -197,23 +336,20 @@ func (h *Handlers) contextHandler(w http.ResponseWriter, r *http.Request, contex
 
 func (h *Handlers) getPage(r *http.Request) (Page, error) {
 	var err error
-	page := Page{Count: h.Step, Offset: 0}
+	page := Page{Count: h.Step}
 
 	query := r.URL.Query()
 
-	countStringArray := query["count"]
-	offsetStringArray := query["offset"]
-
-	if len(countStringArray) > 0 {
-		page.Count, err = parseInt(countStringArray[0])
+	if count := query.Get("count"); count != "" {
+		page.Count, err = parseInt(count)
 		if err != nil {
 			return page, err
 		}
 	}
 
-	if len(offsetStringArray) > 0 {
-		page.Offset, err = parseInt(offsetStringArray[0])
-		if err != nil {
+	page.Cursor = query.Get("cursor")
+	if page.Cursor != "" {
+		if _, err = DecodeCursor(page.Cursor); err != nil {
 			return page, err
 		}
 	}
@@ -223,73 +359,74 @@ func (h *Handlers) getPage(r *http.Request) (Page, error) {
 }
 
 func (h *Handlers) index(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		h.handleErrors(w, r, fmt.Errorf("Unexpected method"), http.StatusMethodNotAllowed)
-		return
-	}
-
 	page, err := h.getPage(r)
 	if err != nil {
-		h.handleErrors(w, r, err, http.StatusInternalServerError)
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
 		return
 	}
 
-	context, err := h.getContext(page)
+	context, err := h.getContext(r.Context(), page)
 	if err != nil {
-		h.handleErrors(w, r, err, http.StatusInternalServerError)
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
 		return
 	}
+
+	if token := r.URL.Query().Get(undo); token != "" {
+		u, err := DecodeUndo(token)
+		if err != nil {
+			h.handleErrors(w, r, err, http.StatusBadRequest)
+			return
+		}
+		context.Message = u.Message()
+		context.Undo = token
+	}
 	h.contextHandler(w, r, context, "index.html")
 
 }
 
 func (h *Handlers) handleDelete(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	matches := delete.FindStringSubmatch(path)
-
-	repetition, err := h.getRep(matches[1])
+	repetition, err := h.getRep(r)
 	if err != nil {
-		h.handleErrors(w, r, err, http.StatusInternalServerError)
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
 		return
 	}
 
 	if r.Method == "GET" {
 		h.contextHandler(w, r, repetition, "delete.html")
 		return
-	} else if r.Method == "POST" {
-		err = h.Storage.Delete(*repetition.ID)
+	} else {
+		err = h.Storage.Delete(r.Context(), *repetition.ID)
 
 		if err != nil {
-			h.handleErrors(w, r, err, http.StatusBadRequest)
+			h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
 			return
 		}
-		http.Redirect(w, r, "/", 301)
+		http.Redirect(w, r, "/?undo="+Undo{Restore: *repetition.ID}.Encode(), http.StatusSeeOther)
 	}
 
 }
 
 func (h *Handlers) handleCopy(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	matches := copy.FindStringSubmatch(path)
-
-	repetition, err := h.getRep(matches[1])
+	repetition, err := h.getRep(r)
 	if err != nil {
-		h.handleErrors(w, r, err, http.StatusInternalServerError)
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
 		return
 	}
 
-	// nil it so when it gets sent back we make a new one.
+	// nil it so when it gets sent back we make a new one, and the copy
+	// isn't mistaken for a retry of the one the client logged.
 	repetition.ID = nil
+	repetition.ClientID = ""
 
 	if r.Method == "GET" {
 		page, err := h.getPage(r)
 		if err != nil {
-			h.handleErrors(w, r, err, http.StatusInternalServerError)
+			h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
 			return
 		}
-		context, err := h.getContext(page)
+		context, err := h.getContext(r.Context(), page)
 		if err != nil {
-			h.handleErrors(w, r, err, http.StatusInternalServerError)
+			h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
 			return
 		}
 
@@ -297,20 +434,16 @@ func (h *Handlers) handleCopy(w http.ResponseWriter, r *http.Request) {
 
 		h.contextHandler(w, r, context, "form.html")
 		return
-	} else if r.Method == "POST" {
-		log.Println("call new creation script with copy")
+	} else {
 		h.handleCreatePost(w, r, repetition)
 	}
 
 }
 
 func (h *Handlers) handleEdit(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	matches := edit.FindStringSubmatch(path)
-
-	repetition, err := h.getRep(matches[1])
+	repetition, err := h.getRep(r)
 	if err != nil {
-		h.handleErrors(w, r, err, http.StatusInternalServerError)
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -318,12 +451,12 @@ func (h *Handlers) handleEdit(w http.ResponseWriter, r *http.Request) {
 
 		page, err := h.getPage(r)
 		if err != nil {
-			h.handleErrors(w, r, err, http.StatusInternalServerError)
+			h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
 			return
 		}
-		context, err := h.getContext(page)
+		context, err := h.getContext(r.Context(), page)
 		if err != nil {
-			h.handleErrors(w, r, err, http.StatusInternalServerError)
+			h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
 			return
 		}
 
@@ -331,61 +464,87 @@ func (h *Handlers) handleEdit(w http.ResponseWriter, r *http.Request) {
 
 		h.contextHandler(w, r, context, "form.html")
 		return
-	} else if r.Method == "POST" {
+	} else {
 		h.handleCreatePost(w, r, repetition)
 	}
 }
 
 func (h *Handlers) handleCreate(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		h.handleCreatePost(w, r, nil)
-	case "GET":
-		h.handleCreateGet(w, r)
-	default:
-		h.handleErrors(w, r, fmt.Errorf("Unexpected method"), http.StatusMethodNotAllowed)
-	}
+	h.handleCreatePost(w, r, nil)
 }
 
 func (h *Handlers) handleCreateGet(w http.ResponseWriter, r *http.Request) {
 
 	page, err := h.getPage(r)
 	if err != nil {
-		h.handleErrors(w, r, err, http.StatusInternalServerError)
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
 		return
 	}
-	context, err := h.getContext(page)
+	context, err := h.getContext(r.Context(), page)
 	if err != nil {
-		h.handleErrors(w, r, err, http.StatusInternalServerError)
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
 		return
 	}
 	h.contextHandler(w, r, context, "form.html")
 }
 
 func (h *Handlers) handleCreatePost(w http.ResponseWriter, r *http.Request, existing *Repetition) {
-	var (
-		err error
-		sd civil.Date
-	)
-
 	repetition := &Repetition{}
+	// previous is how an edited repetition was, so the edit can be undone.
+	var previous *Repetition
 	if existing != nil {
 		repetition = existing
+		if existing.ID != nil {
+			saved := *existing
+			previous = &saved
+		}
 	}
 
 	r.ParseForm()
+	problems := h.formRepetition(r.Context(), r.Form, repetition)
+	if len(problems) > 0 {
+		h.renderInvalid(w, r, repetition, problems)
+		return
+	}
 
-	required := map[string]bool{}
+	reps := make([]Repetition, 1)
+	reps[0] = *repetition
+	err := h.Storage.Load(r.Context(), reps)
 
-	for key, value := range r.Form {
-		if required[key] && len(value) < 1 {
-			// todo: send you back to the same url with an error message
-			http.Error(w, "Missing required field",
-				http.StatusBadRequest)
-			return
-		}
+	var invalid *InvalidRepetitionError
+	if errors.As(err, &invalid) {
+		h.renderInvalid(w, r, repetition, invalid.Fields)
+		return
+	}
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	// a repetition stored before changes were logged has none to revert to.
+	if previous != nil && previous.Seq != 0 {
+		http.Redirect(w, r, "/?undo="+Undo{Revert: *previous.ID, Change: previous.Seq}.Encode(), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+
+}
+
+// formRepetition fills in the repetition from a submitted form, returning
+// what's wrong with any of the fields, by field.
+func (h *Handlers) formRepetition(ctx context.Context, form url.Values, repetition *Repetition) map[string]string {
+	var (
+		err error
+		sd  civil.Date
+		// problems maps repetition fields to what's wrong with them.
+		problems = make(map[string]string)
+	)
+
+	// an unchecked box isn't sent at all.
+	repetition.Failure = form.Get(failure) != ""
 
+	for key, value := range form {
 		if len(value) > 0 {
+			field := key
 			switch key {
 			case (category):
 				repetition.Category = value[0]
@@ -401,10 +560,13 @@ func (h *Handlers) handleCreatePost(w http.ResponseWriter, r *http.Request, exis
 			case (weight):
 				repetition.Weight, err = parseInt(value[0])
 			case (hour):
+				field = "Elapsed"
 				repetition.Elapsed.Hour, err = parseInt(value[0])
 			case (minute):
+				field = "Elapsed"
 				repetition.Elapsed.Minute, err = parseInt(value[0])
 			case (second):
+				field = "Elapsed"
 				repetition.Elapsed.Second, err = parseInt(value[0])
 			case (sets):
 				repetition.Sets, err = parseInt(value[0])
@@ -418,28 +580,1057 @@ func (h *Handlers) handleCreatePost(w http.ResponseWriter, r *http.Request, exis
 				repetition.ID = &ID
 			case (units):
 				repetition.Units = value[0]
-
+			case (failure):
 			default:
-				log.Panicln("unknown field ", key)
+				h.logger().LogAttrs(ctx, slog.LevelDebug, "ignoring unknown field",
+					slog.String("request_id", RequestID(ctx)),
+					slog.String("field", key),
+				)
 			}
 
 			if err != nil {
-				h.handleErrors(w, r, err, http.StatusBadRequest)
-				return
+				problems[field] = "must be a number"
+				if field == sessionDate {
+					problems[field] = "must be a date"
+				}
+				err = nil
 			}
 		} else {
-			log.Printf("skipping %s because no value", key)
+			h.logger().LogAttrs(ctx, slog.LevelDebug, "skipping field without a value",
+				slog.String("request_id", RequestID(ctx)),
+				slog.String("field", key),
+			)
 		}
 	}
 
-	reps := make([]Repetition, 1)
-	reps[0] = *repetition
-	err = h.Storage.Load(reps)
+	var invalid *InvalidRepetitionError
+	if err = repetition.Validate(); errors.As(err, &invalid) {
+		for field, problem := range invalid.Fields {
+			if _, ok := problems[field]; !ok {
+				problems[field] = problem
+			}
+		}
+	}
+	return problems
+}
+
+// renderInvalid shows the form again with what was submitted and what's wrong
+// with it.
+func (h *Handlers) renderInvalid(w http.ResponseWriter, r *http.Request, repetition *Repetition, problems map[string]string) {
+	context, err := h.getContext(r.Context(), Page{Count: h.Step})
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	context.Repetition = repetition
+	context.Errors = problems
+
+	w.WriteHeader(http.StatusBadRequest)
+	h.contextHandler(w, r, context, "form.html")
+}
+
+func (h *Handlers) handleImport(w http.ResponseWriter, r *http.Request) {
+	page, err := h.getPage(r)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+	context, err := h.getContext(r.Context(), page)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	h.contextHandler(w, r, context, "import.html")
+}
+
+func (h *Handlers) handleImportPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(maxTrackSize)
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile(trackFile)
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	format, err := ActivityFormat(header.Filename)
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
 
+	data, err := ioutil.ReadAll(file)
 	if err != nil {
 		h.handleErrors(w, r, err, http.StatusBadRequest)
 		return
 	}
-	http.Redirect(w, r, "/", 301)
 
+	category := r.FormValue(category)
+	if category == "" {
+		category = "aerobic"
+	}
+	distanceUnits := r.FormValue(units)
+	if distanceUnits == "" {
+		distanceUnits = "miles"
+	}
+
+	rep, err := ImportActivity(r.Context(), h.Storage, format, data, category, distanceUnits)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/track/%d", *rep.ID), http.StatusSeeOther)
+}
+
+// TrackContext is what the track page needs to draw an imported activity.
+type TrackContext struct {
+	Repetition       *Repetition
+	Activity         *Activity
+	Distance         float64
+	ElevationGain    float64
+	AverageHeartRate int
+	MovingTime       time.Duration
+	// Path is the track projected into a trackViewBox sized box, as svg
+	// polyline points.
+	Path string
+}
+
+// trackViewBox is the size of the svg the track is drawn into.
+const trackViewBox = 1000
+
+// trackPath projects the track onto a flat box, good enough at the scale of
+// a run, and formats it as svg polyline points.
+func trackPath(a *Activity) string {
+	var (
+		points                 []TrackPoint
+		minX, minY, maxX, maxY float64
+	)
+
+	for _, p := range a.Points {
+		if p.HasPosition {
+			points = append(points, p)
+		}
+	}
+	if len(points) == 0 {
+		return ""
+	}
+
+	scale := math.Cos(points[0].Latitude * math.Pi / 180)
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	for i, p := range points {
+		xs[i], ys[i] = p.Longitude*scale, -p.Latitude
+		if i == 0 || xs[i] < minX {
+			minX = xs[i]
+		}
+		if i == 0 || xs[i] > maxX {
+			maxX = xs[i]
+		}
+		if i == 0 || ys[i] < minY {
+			minY = ys[i]
+		}
+		if i == 0 || ys[i] > maxY {
+			maxY = ys[i]
+		}
+	}
+
+	span := math.Max(maxX-minX, maxY-minY)
+	if span == 0 {
+		span = 1
+	}
+
+	path := make([]string, len(points))
+	for i := range points {
+		path[i] = fmt.Sprintf("%.1f,%.1f",
+			(xs[i]-minX)/span*trackViewBox,
+			(ys[i]-minY)/span*trackViewBox,
+		)
+	}
+	return strings.Join(path, " ")
+}
+
+func (h *Handlers) handleTrack(w http.ResponseWriter, r *http.Request) {
+	repetition, err := h.getRep(r)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	t, err := h.Storage.GetTrack(r.Context(), *repetition.ID)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	if r.URL.Query().Get("download") != "" {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=%d.%s", t.RepetitionID, t.Format))
+		w.Write(t.Data)
+		return
+	}
+
+	activity, err := ParseActivity(t.Format, bytes.NewReader(t.Data))
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.contextHandler(w, r, &TrackContext{
+		Repetition:       repetition,
+		Activity:         activity,
+		Distance:         repetition.Volume,
+		ElevationGain:    activity.ElevationGain(),
+		AverageHeartRate: activity.AverageHeartRate(),
+		MovingTime:       activity.MovingTime(),
+		Path:             trackPath(activity),
+	}, "track.html")
+}
+
+// PaceChart is the pace trend of one exercise, drawn as an svg sparkline.
+type PaceChart struct {
+	Exercise string
+	Points   string
+	Fastest  Pace
+	Slowest  Pace
+	Latest   Pace
+}
+
+// AnalyticsContext is what the analytics page needs.
+type AnalyticsContext struct {
+	DistanceAnalytics
+	// Window is how many weeks back we looked.
+	Window   int
+	Charts   []PaceChart
+	Strength []RelativeStrength
+	Sex      Sex
+}
+
+const (
+	chartWidth  = 300
+	chartHeight = 60
+)
+
+// getAnalyticsWindow retrieves the repetitions from the last few weeks, as
+// given by the weeks query parameter.
+func (h *Handlers) getAnalyticsWindow(r *http.Request) ([]Repetition, int, error) {
+	weeks, err := parseInt(r.URL.Query().Get("weeks"))
+	if err != nil {
+		return nil, 0, err
+	}
+	if weeks <= 0 {
+		weeks = 12
+	}
+
+	today := civil.DateOf(time.Now())
+	reps, err := h.Storage.GetBetween(r.Context(), WeekOf(today).AddDays(-7*(weeks-1)), today)
+	return reps, weeks, err
+}
+
+// getDistanceAnalytics analyzes distance work in the repetitions, as given by
+// the exercise and units query parameters.
+func (h *Handlers) getDistanceAnalytics(r *http.Request, reps []Repetition) (DistanceAnalytics, error) {
+	query := r.URL.Query()
+
+	distanceUnits := query.Get("units")
+	if distanceUnits == "" {
+		distanceUnits = "miles"
+	}
+
+	return AnalyzeDistance(reps, query.Get("exercise"), distanceUnits)
+}
+
+// getBodyweights retrieves every bodyweight ever logged.
+func (h *Handlers) getBodyweights(ctx context.Context) (Bodyweights, error) {
+	ms, err := h.Storage.GetMeasurements(ctx, Bodyweight, civil.Date{Year: 1900, Month: 1, Day: 1}, civil.DateOf(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	return NewBodyweights(ms), nil
+}
+
+// getStrength compares the heaviest lifts in reps to your bodyweight, scoring
+// them for the sex query parameter if it's given.
+func (h *Handlers) getStrength(r *http.Request, reps []Repetition) ([]RelativeStrength, Sex, error) {
+	var (
+		sex Sex
+		err error
+	)
+	if s := r.URL.Query().Get("sex"); s != "" {
+		sex, err = ParseSex(s)
+		if err != nil {
+			return nil, sex, err
+		}
+	}
+
+	bodyweights, err := h.getBodyweights(r.Context())
+	if err != nil {
+		return nil, sex, err
+	}
+	return AnalyzeStrength(reps, bodyweights, sex), sex, nil
+}
+
+func (h *Handlers) handleAnalytics(w http.ResponseWriter, r *http.Request) {
+	reps, weeks, err := h.getAnalyticsWindow(r)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+
+	analytics, err := h.getDistanceAnalytics(r, reps)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+
+	strength, sex, err := h.getStrength(r, reps)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+
+	exercises := make([]string, 0, len(analytics.Trends))
+	for exercise := range analytics.Trends {
+		exercises = append(exercises, exercise)
+	}
+	sort.Strings(exercises)
+
+	charts := make([]PaceChart, 0, len(exercises))
+	for _, exercise := range exercises {
+		trend := analytics.Trends[exercise]
+		chart := PaceChart{Exercise: exercise, Latest: trend[len(trend)-1].Pace}
+		values := make([]float64, len(trend))
+		for i, p := range trend {
+			values[i] = float64(p.Pace)
+			if i == 0 || p.Pace < chart.Fastest {
+				chart.Fastest = p.Pace
+			}
+			if p.Pace > chart.Slowest {
+				chart.Slowest = p.Pace
+			}
+		}
+		chart.Points = sparkline(values, chartWidth, chartHeight)
+		charts = append(charts, chart)
+	}
+
+	h.contextHandler(w, r, &AnalyticsContext{
+		DistanceAnalytics: analytics,
+		Window:            weeks,
+		Charts:            charts,
+		Strength:          strength,
+		Sex:               sex,
+	}, "analytics.html")
+}
+
+func (h *Handlers) handleDistanceAPI(w http.ResponseWriter, r *http.Request) {
+	reps, _, err := h.getAnalyticsWindow(r)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+
+	analytics, err := h.getDistanceAnalytics(r, reps)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+
+	h.writeJSON(w, r, analytics)
+}
+
+func (h *Handlers) handleStrengthAPI(w http.ResponseWriter, r *http.Request) {
+	reps, _, err := h.getAnalyticsWindow(r)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+
+	strength, _, err := h.getStrength(r, reps)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+
+	h.writeJSON(w, r, strength)
+}
+
+func (h *Handlers) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		h.logger().LogAttrs(r.Context(), slog.LevelError, "encoding json",
+			slog.String("request_id", RequestID(r.Context())),
+			slog.String("path", r.URL.Path),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// APIError is what's wrong with a request to the JSON API, with what's wrong
+// with each field of a repetition that couldn't be stored.
+type APIError struct {
+	Error  string
+	Fields map[string]string `json:",omitempty"`
+}
+
+// maxAPIBody is the largest repetition we'll read from the JSON API.
+const maxAPIBody = 1 << 20
+
+// handleCreateAPI stores a repetition sent as JSON, created with 201, or
+// already stored with 200. It needs a ClientID: sending one that's already
+// stored gets the stored repetition back rather than storing it twice, so
+// clients can retry until they hear back, e.g. after logging offline.
+func (h *Handlers) handleCreateAPI(w http.ResponseWriter, r *http.Request) {
+	var repetition Repetition
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxAPIBody)).Decode(&repetition); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeJSON(w, r, APIError{Error: err.Error()})
+		return
+	}
+	if repetition.ClientID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeJSON(w, r, APIError{Error: "a ClientID is needed to store it exactly once"})
+		return
+	}
+	repetition.ID = nil
+	var invalid *InvalidRepetitionError
+	if err := repetition.Validate(); errors.As(err, &invalid) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeJSON(w, r, APIError{Error: err.Error(), Fields: invalid.Fields})
+		return
+	}
+
+	existing, err := h.Storage.GetByClientID(r.Context(), repetition.ClientID)
+	if err == nil {
+		h.writeJSON(w, r, existing)
+		return
+	}
+	if !errors.Is(err, ErrNotFound) {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	reps := []Repetition{repetition}
+	err = h.Storage.Load(r.Context(), reps)
+	if errors.Is(err, ErrConflict) {
+		// the same repetition sent twice at once, the other got there first.
+		if existing, err = h.Storage.GetByClientID(r.Context(), repetition.ClientID); err == nil {
+			h.writeJSON(w, r, existing)
+			return
+		}
+	}
+	if errors.As(err, &invalid) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeJSON(w, r, APIError{Error: err.Error(), Fields: invalid.Fields})
+		return
+	}
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	stored, err := h.Storage.GetByID(r.Context(), *reps[0].ID)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/edit/%d", *stored.ID))
+	w.WriteHeader(http.StatusCreated)
+	h.writeJSON(w, r, stored)
+}
+
+// MeasurementsContext is what the measurements page needs.
+type MeasurementsContext struct {
+	Kind  string
+	Kinds []string
+	Sites []string
+	// Days is how far back we looked, Smoothing the days averaged over.
+	Days, Smoothing int
+	Trend           []TrendPoint
+	// Points charts the smoothed trend.
+	Points string
+	Now    string
+	Units  string
+}
+
+func (h *Handlers) handleMeasurementsGet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	kind := query.Get("kind")
+	if kind == "" {
+		kind = Bodyweight
+	}
+
+	days, err := parseInt(query.Get("days"))
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if days <= 0 {
+		days = 90
+	}
+
+	smoothing, err := parseInt(query.Get("smoothing"))
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if smoothing <= 0 {
+		smoothing = 7
+	}
+
+	today := civil.DateOf(time.Now())
+	ms, err := h.Storage.GetMeasurements(r.Context(), kind, today.AddDays(-days), today)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	context := &MeasurementsContext{
+		Kind:      kind,
+		Days:      days,
+		Smoothing: smoothing,
+		Trend:     MovingAverage(ms, smoothing),
+		Now:       now(),
+	}
+
+	sites := make(map[string]bool)
+	values := make([]float64, len(context.Trend))
+	for i, p := range context.Trend {
+		// negated so bigger readings are drawn higher up.
+		values[i] = -p.Average
+		if p.Site != "" && !sites[p.Site] {
+			sites[p.Site] = true
+			context.Sites = append(context.Sites, p.Site)
+		}
+		context.Units = p.Units
+	}
+	context.Points = sparkline(values, chartWidth, chartHeight)
+
+	for _, k := range MeasurementKinds {
+		context.Kinds = append(context.Kinds, k.Kind)
+		if k.Kind == kind && context.Units == "" {
+			context.Units = k.Units
+		}
+	}
+
+	h.contextHandler(w, r, context, "measurements.html")
+}
+
+const (
+	kind       = "Kind"
+	site       = "Site"
+	value      = "Value"
+	measuredOn = "Date"
+)
+
+func (h *Handlers) handleMeasurementsPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	m := Measurement{
+		Kind:    r.Form.Get(kind),
+		Site:    r.Form.Get(site),
+		Units:   r.Form.Get(units),
+		Comment: r.Form.Get(comment),
+	}
+
+	m.Value, err = strconv.ParseFloat(r.Form.Get(value), 64)
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	m.Date, err = ParseSessionDateString(r.Form.Get(measuredOn))
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Storage.LoadMeasurements(r.Context(), []Measurement{m})
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusBadRequest))
+		return
+	}
+	http.Redirect(w, r, "/measurements/?kind="+url.QueryEscape(m.Kind), http.StatusSeeOther)
+}
+
+// ScoresContext is what the scores page needs.
+type ScoresContext struct {
+	Sex Sex
+	// Window is the days a total can be spread over, Days how far back the
+	// history goes.
+	Window, Days int
+	Current      Total
+	History      []Total
+	// Points charts the DOTS score over time.
+	Points string
+}
+
+func (h *Handlers) handleScores(w http.ResponseWriter, r *http.Request) {
+	var (
+		query   = r.URL.Query()
+		context = ScoresContext{}
+		err     error
+	)
+
+	if s := query.Get("sex"); s != "" {
+		context.Sex, err = ParseSex(s)
+		if err != nil {
+			h.handleErrors(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	context.Window, err = parseInt(query.Get("window"))
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if context.Window <= 0 {
+		context.Window = 90
+	}
+
+	context.Days, err = parseInt(query.Get("days"))
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if context.Days <= 0 {
+		context.Days = 365
+	}
+
+	today := civil.DateOf(time.Now())
+	reps, err := h.Storage.GetBetween(r.Context(), today.AddDays(1-context.Days-context.Window), today)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	bodyweights, err := h.getBodyweights(r.Context())
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	context.Current = BestTotal(reps, bodyweights, context.Sex, today.AddDays(1-context.Window), today)
+
+	first := today.AddDays(1 - context.Days)
+	values := make([]float64, 0)
+	for _, t := range ScoreHistory(reps, bodyweights, context.Sex, context.Window) {
+		if t.End.Before(first) {
+			continue
+		}
+		context.History = append(context.History, t)
+		// negated so better scores are drawn higher up.
+		values = append(values, -t.DOTS)
+	}
+	context.Points = sparkline(values, chartWidth, chartHeight)
+
+	h.contextHandler(w, r, &context, "scores.html")
+}
+
+// SearchContext is what the search page needs: the usual context for the
+// table and the drop downs, plus the query and a link to the next page.
+type SearchContext struct {
+	*Context
+	Query Query
+	Sorts []Sort
+	// NextURL and PreviousURL link to the pages around this one, empty at
+	// either end.
+	NextURL, PreviousURL string
+}
+
+// Selected is true if the value is one of the chosen filter values.
+func (c *SearchContext) Selected(chosen []string, value string) bool {
+	for _, v := range chosen {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getQuery reads a search query from the url parameters.
+func getQuery(values url.Values) (Query, error) {
+	var err error
+	q := Query{
+		Exercises:   values["exercise"],
+		Categories:  values["category"],
+		Units:       values["units"],
+		FailureOnly: values.Get("failure") != "",
+		Text:        strings.TrimSpace(values.Get("q")),
+		Cursor:      values.Get("cursor"),
+	}
+
+	q.Sort, err = ParseSort(values.Get("sort"))
+	if err != nil {
+		return q, err
+	}
+
+	for param, field := range map[string]*int{
+		"min_effort": &q.MinEffort,
+		"max_effort": &q.MaxEffort,
+		"min_weight": &q.MinWeight,
+		"max_weight": &q.MaxWeight,
+		"count":      &q.Count,
+	} {
+		*field, err = parseInt(values.Get(param))
+		if err != nil {
+			return q, fmt.Errorf("%s: %v", param, err)
+		}
+	}
+	return q, nil
+}
+
+// dropEmpty removes the blank choices a form submits for unselected filters.
+func dropEmpty(values []string) []string {
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func (h *Handlers) handleSearch(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	query, err := getQuery(values)
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+	query.Exercises = dropEmpty(query.Exercises)
+	query.Categories = dropEmpty(query.Categories)
+	query.Units = dropEmpty(query.Units)
+	if query.Count <= 0 {
+		query.Count = h.Step
+	}
+
+	result, err := h.Storage.Search(r.Context(), query)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	context, err := h.newContext(r.Context(), result, Page{Count: query.Count, Cursor: query.Cursor})
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	// the table's links page through the history, we have our own.
+	context.CanGoEarlier, context.CanGoLater = false, false
+
+	search := SearchContext{
+		Context: context,
+		Query:   query,
+		Sorts:   []Sort{Newest, Oldest, Heaviest, Hardest},
+	}
+	if result.Next != "" {
+		values.Set("cursor", result.Next)
+		search.NextURL = "/search/?" + values.Encode()
+	}
+	if result.Previous != "" {
+		values.Set("cursor", result.Previous)
+		search.PreviousURL = "/search/?" + values.Encode()
+	}
+
+	h.contextHandler(w, r, &search, "search.html")
+}
+
+// TrashContext is the context for the trash page.
+type TrashContext struct {
+	Trashed   []Trashed
+	Retention time.Duration
+	Message   string
+}
+
+// RetentionDays is how many days things are kept in the trash.
+func (c *TrashContext) RetentionDays() int {
+	return int(c.Retention.Hours() / 24)
+}
+
+func (h *Handlers) retention() time.Duration {
+	if h.Retention <= 0 {
+		return DefaultRetention
+	}
+	return h.Retention
+}
+
+// handleTrash lists what's in the trash, and empties it on a POST.
+func (h *Handlers) handleTrash(w http.ResponseWriter, r *http.Request) {
+	var message string
+	if r.Method == "POST" {
+		purged, err := h.Storage.Purge(r.Context(), time.Now())
+		if err != nil {
+			h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+			return
+		}
+		message = fmt.Sprintf("permanently deleted %d repetitions", purged)
+	}
+
+	trashed, err := h.Storage.GetTrash(r.Context())
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	h.contextHandler(w, r, &TrashContext{Trashed: trashed, Retention: h.retention(), Message: message}, "trash.html")
+}
+
+func (h *Handlers) handleRestore(w http.ResponseWriter, r *http.Request) {
+	ID, err := pathID(r)
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err = h.Storage.Restore(r.Context(), ID); err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	http.Redirect(w, r, "/trash/", http.StatusSeeOther)
+}
+
+// handleUndo takes back the change in the undo token that was posted.
+func (h *Handlers) handleUndo(w http.ResponseWriter, r *http.Request) {
+	u, err := DecodeUndo(r.FormValue(undo))
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if err = u.Apply(r.Context(), h.Storage); err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// HistoryContext is the context for the history of changes to a repetition.
+type HistoryContext struct {
+	ID int
+	// Repetition is how it is now, nil if it's in the trash.
+	Repetition *Repetition
+	// Changes are newest first.
+	Changes []Change
+}
+
+// handleHistory shows the changes made to a repetition.
+func (h *Handlers) handleHistory(w http.ResponseWriter, r *http.Request) {
+	ID, err := pathID(r)
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	history, err := h.Storage.GetChanges(r.Context(), ID)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	if len(history) == 0 {
+		err = fmt.Errorf("history of repetition %d: %w", ID, ErrNotFound)
+		h.handleErrors(w, r, err, http.StatusNotFound)
+		return
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	context := HistoryContext{ID: ID, Changes: history}
+	context.Repetition, err = h.Storage.GetByID(r.Context(), ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	h.contextHandler(w, r, &context, "history.html")
+}
+
+// handleRevert puts a repetition back how it was after the posted change.
+func (h *Handlers) handleRevert(w http.ResponseWriter, r *http.Request) {
+	ID, err := pathID(r)
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusNotFound)
+		return
+	}
+	changeID, err := parseInt(r.FormValue(change))
+	if err != nil {
+		h.handleErrors(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if err = Revert(r.Context(), h.Storage, ID, changeID); err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/history/%d", ID), http.StatusSeeOther)
+}
+
+// streaming is true if the request is for the change feed as Server-Sent
+// Events.
+func streaming(r *http.Request) bool {
+	return r.URL.Path == "/api/changes" && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// ChangeFeed is a page of the change feed as JSON.
+type ChangeFeed struct {
+	Changes []Change
+	// Next is the sequence number to ask for changes since next time.
+	Next int
+}
+
+// handleChangeFeed serves the changes since the sequence number in the since
+// parameter. Asked for text/event-stream, it keeps streaming new changes as
+// Server-Sent Events until the client goes away, picking up from the
+// Last-Event-ID when the client reconnects. Otherwise it's a page of JSON.
+func (h *Handlers) handleChangeFeed(w http.ResponseWriter, r *http.Request) {
+	since := r.URL.Query().Get("since")
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		since = last
+	}
+	seq := 0
+	if since != "" {
+		var err error
+		if seq, err = strconv.Atoi(since); err != nil || seq < 0 {
+			h.handleErrors(w, r, fmt.Errorf("%w: bad sequence number %q", ErrInvalidQuery, since), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !streaming(r) {
+		changes, err := h.Storage.ChangesSince(r.Context(), seq)
+		if err != nil {
+			h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+			return
+		}
+		feed := ChangeFeed{Changes: changes, Next: seq}
+		if len(changes) > 0 {
+			feed.Next = changes[len(changes)-1].ID
+		}
+		h.writeJSON(w, r, feed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.handleErrors(w, r, fmt.Errorf("streaming isn't supported"), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	// the stream outlasts the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	poll := h.PollInterval
+	if poll <= 0 {
+		poll = time.Second
+	}
+	for {
+		changes, err := h.pollChanges(r.Context(), seq)
+		if err != nil {
+			if r.Context().Err() == nil {
+				h.logger().LogAttrs(r.Context(), slog.LevelError, "polling the change feed",
+					slog.String("request_id", RequestID(r.Context())),
+					slog.String("error", err.Error()),
+				)
+			}
+			return
+		}
+		for _, c := range changes {
+			data, err := json.Marshal(c)
+			if err != nil {
+				h.logger().LogAttrs(r.Context(), slog.LevelError, "encoding change",
+					slog.String("request_id", RequestID(r.Context())),
+					slog.Int("change", c.ID),
+					slog.String("error", err.Error()),
+				)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", c.ID, c.Action, data)
+			seq = c.ID
+		}
+		flusher.Flush()
+
+		// a full page means there's more waiting.
+		if len(changes) == ChangeFeedPage {
+			continue
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.Done:
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+// pollChanges gets the changes since seq for the change feed, with the
+// timeout a request would get.
+func (h *Handlers) pollChanges(ctx context.Context, seq int) ([]Change, error) {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	return h.Storage.ChangesSince(ctx, seq)
+}
+
+// handleHealthz says the server is up.
+func (h *Handlers) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz says whether the server can reach its storage.
+func (h *Handlers) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := h.Storage.Ping(r.Context()); err != nil {
+		h.logger().LogAttrs(r.Context(), slog.LevelWarn, "not ready",
+			slog.String("request_id", RequestID(r.Context())),
+			slog.String("error", err.Error()),
+		)
+		http.Error(w, "storage unreachable", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleMetrics serves the metrics in the Prometheus text format, with how
+// many repetitions have been logged today and are in the trash.
+func (h *Handlers) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.Metrics == nil {
+		h.handleErrors(w, r, fmt.Errorf("metrics: %w", ErrNotFound), http.StatusNotFound)
+		return
+	}
+	today := civil.DateOf(time.Now())
+	logged, err := h.Storage.CountBetween(r.Context(), today, today)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	trashed, err := h.Storage.CountTrash(r.Context())
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err = h.Metrics.WritePrometheus(w); err != nil {
+		return
+	}
+	WriteGauge(w, "lifting_repetitions_today", "Repetitions logged for today.", float64(logged))
+	WriteGauge(w, "lifting_trash_repetitions", "Repetitions in the trash.", float64(trashed))
 }
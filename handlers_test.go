@@ -0,0 +1,76 @@
+package lifting
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/civil"
+)
+
+// stubStorage keeps repetitions in a map, enough for the handlers that only
+// get and load them. Anything else panics.
+type stubStorage struct {
+	ContextStorage
+	reps map[int]Repetition
+}
+
+func (s *stubStorage) GetByID(ctx context.Context, id int) (*Repetition, error) {
+	rep, ok := s.reps[id]
+	if !ok {
+		return nil, fmt.Errorf("repetition %d: %w", id, ErrNotFound)
+	}
+	return &rep, nil
+}
+
+func (s *stubStorage) Load(ctx context.Context, reps []Repetition) error {
+	for i := range reps {
+		for _, stored := range s.reps {
+			if reps[i].ClientID != "" && reps[i].ClientID == stored.ClientID && (reps[i].ID == nil || *reps[i].ID != *stored.ID) {
+				return fmt.Errorf("client id %s: %w", reps[i].ClientID, ErrConflict)
+			}
+		}
+		if reps[i].ID == nil {
+			id := len(s.reps) + 1
+			reps[i].ID = &id
+		}
+		s.reps[*reps[i].ID] = reps[i]
+	}
+	return nil
+}
+
+func TestCopyClientID(t *testing.T) {
+	id := 1
+	storage := &stubStorage{reps: map[int]Repetition{id: {
+		ID:          &id,
+		Exercise:    "squat",
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+		Units:       "lbs",
+		Category:    "strength",
+		ClientID:    "phone-1",
+	}}}
+	h := &Handlers{Storage: storage}
+
+	form := url.Values{
+		"Exercise":    {"squat"},
+		"SessionDate": {"2018-12-21"},
+		"Units":       {"lbs"},
+		"Category":    {"strength"},
+	}
+	r := httptest.NewRequest("POST", "/copy/1", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.Handle(w, r)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", http.StatusSeeOther), fmt.Sprintf("found %#v", w.Code), w.Body.String())
+	}
+	copied, ok := storage.reps[2]
+	if !ok || copied.ClientID != "" || copied.SessionDate.Day != 21 {
+		t.Fatal("expected a copy without the client's ID", storage.reps)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"cloud.google.com/go/civil"
 	"fmt"
 	"github.com/awinterman/lifting"
-	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"strconv"
 	"time"
@@ -21,7 +20,6 @@ func logWorkout(cmd *cobra.Command, args []string) {
 		volume            string
 		weight            string
 		duration          string
-		failure           string
 
 		// things can go wrong literally whenever
 		err error
@@ -66,11 +64,8 @@ func logWorkout(cmd *cobra.Command, args []string) {
 		}
 
 		enterVolume = Ask{
-			Label: "Volume: ",
-			Validate: func(s string) error {
-				_, err = strconv.ParseFloat(s, 64)
-				return err
-			},
+			Label:    "Volume: ",
+			Validate: validateFloat,
 		}
 
 		enterWeight = Ask{
@@ -99,6 +94,7 @@ func logWorkout(cmd *cobra.Command, args []string) {
 
 		rep        = lifting.Repetition{}
 		previously lifting.Repetition
+		summary    sessionSummary
 
 		// to insert
 		toLoad = make([]lifting.Repetition, 0)
@@ -144,7 +140,10 @@ func logWorkout(cmd *cobra.Command, args []string) {
 		enterVolume.Default = strconv.FormatFloat(previously.Volume, 'f', 2, 64)
 		enterWeight.Default = strconv.Itoa(previously.Weight)
 		enterDuration.Default = previously.Elapsed.String()
-		enterFailure.Default = strconv.FormatBool(previously.Failure)
+		enterFailure.Default = ""
+		if previously.Failure {
+			enterFailure.Default = "y"
+		}
 
 		// units
 		rep.Units, err = enterUnits.Run()
@@ -172,11 +171,8 @@ func logWorkout(cmd *cobra.Command, args []string) {
 		handle(err)
 
 		// failure
-		failure, err = enterFailure.Run()
-		if err == promptui.ErrAbort {
-			failure = "false"
-		}
-		rep.Failure, err = strconv.ParseBool(failure)
+		// a yes is "y", which isn't a bool.
+		rep.Failure, err = enterFailure.Confirm()
 		handle(err)
 
 		// duration
@@ -221,12 +217,24 @@ func logWorkout(cmd *cobra.Command, args []string) {
 		} else if err == nil {
 			for i := 0; i < rep.Sets; i++ {
 				toLoad = append(toLoad, rep)
+				summary.add(rep)
+				// the rest was before the first of them.
+				rep.Rest = 0
+			}
+			finished := time.Now()
+			if addSession {
+				fmt.Printf("session so far: %s\n", summary)
 			}
 			done, err := enterDone.Confirm()
 			handle(err)
 			if done {
 				break
 			}
+			if addSession {
+				rested, err := rest(finished)
+				handle(err)
+				rep.Rest = rested.Round(time.Second)
+			}
 		} else {
 			handle(err)
 		}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/awinterman/lifting"
+	"github.com/awinterman/lifting/sqlite"
+)
+
+// useMemory points the commands at an empty sqlite database in memory.
+func useMemory(t *testing.T) {
+	backend, err := sqlite.CreateStorage(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage = lifting.Adapt(backend)
+}
+
+// answers has the prompts answered by the lines of script.
+func answers(t *testing.T, script ...string) *scriptPrompter {
+	p, err := newScriptPrompter(strings.NewReader(strings.Join(script, "\n")), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompter = p
+	return p
+}
+
+func logged(t *testing.T) []lifting.Repetition {
+	result, err := storage.GetLast(100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Repetitions
+}
+
+func TestAdd(t *testing.T) {
+	useMemory(t)
+	script := answers(t,
+		"2018-12-20", // date
+		"strength",   // workout type
+		"squat",      // exercise
+		"lbs",        // units
+		"5",          // volume
+		"3",          // sets
+		"225",        // weight
+		"n",          // failure
+		"",           // duration, the default
+		"70",         // effort
+		"y",          // looks correct
+		"y",          // done
+	)
+	logWorkout(nil, nil)
+
+	if script.asked != len(script.answers) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v answers", len(script.answers)), fmt.Sprintf("found %#v", script.asked))
+	}
+	reps := logged(t)
+	if len(reps) != 3 {
+		t.Fatal("expected a repetition for each set", reps)
+	}
+	// sqlite doesn't keep the sets, it's a row for each.
+	for _, r := range reps {
+		r.ID, r.CreatedAt, r.UpdatedAt, r.Seq = nil, time.Time{}, time.Time{}, 0
+		expected := lifting.Repetition{
+			Exercise:    "squat",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "lbs",
+			Effort:      70,
+			Volume:      5,
+			Weight:      225,
+			Category:    "strength",
+		}
+		if r != expected {
+			t.Fatal("mimsatch", fmt.Sprintf("expected %#v", expected), fmt.Sprintf("found %#v", r))
+		}
+	}
+}
+
+func TestAddFailure(t *testing.T) {
+	useMemory(t)
+	answers(t, "strength", "bench", "lbs", "3", "1", "245", "y", "", "y", "y")
+	logWorkout(nil, []string{"2018-12-21"})
+
+	reps := logged(t)
+	if len(reps) != 1 {
+		t.Fatal("expected one set", reps)
+	}
+	// a failed set is as hard as it gets, so effort isn't asked.
+	if !reps[0].Failure || reps[0].Effort != 100 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "a failure at effort 100"), fmt.Sprintf("found %#v", reps[0]))
+	}
+}
+
+func TestAddSession(t *testing.T) {
+	useMemory(t)
+	addSession, addRest = true, 0
+	defer func() { addSession, addRest = false, 0 }()
+
+	answers(t,
+		"strength", "squat", "lbs", "5", "1", "225", "n", "", "70", "y",
+		"n", // not done
+		"",  // start the next set
+		"bench", "lbs", "5", "1", "185", "n", "", "60", "y",
+		"y", // done
+	)
+	logWorkout(nil, []string{"2018-12-22"})
+
+	byExercise := make(map[string]lifting.Repetition)
+	for _, r := range logged(t) {
+		byExercise[r.Exercise] = r
+	}
+	if byExercise["squat"].Rest != 0 {
+		t.Fatal("the first set of a session has no rest before it", byExercise["squat"])
+	}
+	// the rest is timed to the second, from when the squat was confirmed to
+	// when the bench was started.
+	if byExercise["bench"].Rest < 0 || byExercise["bench"].Rest > time.Minute || byExercise["bench"].Comment != "" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "the rest before the bench, and no comment"), fmt.Sprintf("found %#v", byExercise["bench"]))
+	}
+}
+
+func TestSessionSummary(t *testing.T) {
+	var summary sessionSummary
+	if s := summary.String(); s != "0 sets" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "0 sets"), fmt.Sprintf("found %#v", s))
+	}
+	for _, r := range []lifting.Repetition{
+		{Exercise: "squat", Volume: 5, Weight: 225, Units: "lbs"},
+		{Exercise: "squat", Volume: 5, Weight: 225, Units: "lbs"},
+		{Exercise: "deadlift", Volume: 3, Weight: 100, Units: "kg"},
+		// a run is a set, but not any weight.
+		{Exercise: "run", Volume: 1, Units: "miles", Elapsed: civil.Time{Minute: 8}},
+	} {
+		summary.add(r)
+	}
+	if s := summary.String(); s != "4 sets, 300 kg, 2250 lbs" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "4 sets, 300 kg, 2250 lbs"), fmt.Sprintf("found %#v", s))
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	countdownTick = time.Millisecond
+	defer func() { countdownTick = time.Second }()
+
+	var out strings.Builder
+	countdown(context.Background(), &out, 5*time.Millisecond)
+	if !strings.HasPrefix(out.String(), "\rresting 0:00") || !strings.HasSuffix(out.String(), "\arest is up                    \n") {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "resting, then the bell"), fmt.Sprintf("found %#v", out.String()))
+	}
+
+	// skipping cuts the rest short, without the bell. The tick is long so
+	// it's the skip that ends it.
+	countdownTick = time.Hour
+	skip, cancel := context.WithCancel(context.Background())
+	cancel()
+	var skipped strings.Builder
+	countdown(skip, &skipped, time.Hour)
+	if skipped.String() != "\rresting 60:00, ctrl-c to skip \n" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "the rest to be skipped"), fmt.Sprintf("found %#v", skipped.String()))
+	}
+}
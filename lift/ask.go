@@ -1,6 +1,14 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
 	"github.com/manifoldco/promptui"
 )
 
@@ -15,13 +23,106 @@ type Ask struct {
 	Validate  func(arg string) error
 }
 
-func readlineRun(ask *Ask) (string, error) {
+// Prompter asks the questions. Whichever it is, a confirmation answered no
+// is promptui.ErrAbort, and a yes is "y".
+type Prompter interface {
+	Prompt(ask *Ask) (string, error)
+}
+
+// prompter is the Prompter every Ask uses, see choosePrompter.
+var prompter Prompter = promptuiPrompter{}
 
-	return "", nil
+var (
+	// promptsFlag picks the prompter, see choosePrompter.
+	promptsFlag string
+	// answersFlag is a file of answers to the prompts, one a line.
+	answersFlag string
+)
+
+// choosePrompter picks the prompter the flags ask for: the answers in a
+// file, promptui's menus, or plain lines that work over a pipe or a dumb
+// terminal. Left to itself it uses promptui on a terminal.
+func choosePrompter() error {
+	if answersFlag != "" {
+		f, err := os.Open(answersFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		script, err := newScriptPrompter(f, os.Stdout)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", answersFlag, err)
+		}
+		prompter = script
+		return nil
+	}
 
+	switch promptsFlag {
+	case "promptui":
+		prompter = promptuiPrompter{}
+	case "plain":
+		prompter = newLinePrompter(os.Stdin, os.Stdout)
+	case "", "auto":
+		if readline.IsTerminal(int(os.Stdin.Fd())) && os.Getenv("TERM") != "dumb" {
+			prompter = promptuiPrompter{}
+		} else {
+			prompter = newLinePrompter(os.Stdin, os.Stdout)
+		}
+	default:
+		return fmt.Errorf("--prompts is auto, promptui or plain, not %q", promptsFlag)
+	}
+	return nil
 }
 
-func promptuiRun(ask *Ask) (string, error) {
+// answer is what a line typed in reply means: the default if it's blank, the
+// item if it's an item's number, and an error if it isn't valid.
+func answer(ask *Ask, line string) (string, error) {
+	line = strings.TrimSpace(line)
+	if ask.IsConfirm {
+		switch strings.ToLower(line) {
+		case "y", "yes":
+			return "y", nil
+		case "":
+			if strings.EqualFold(ask.Default, "y") {
+				return "y", nil
+			}
+		}
+		return "", promptui.ErrAbort
+	}
+
+	if line == "" {
+		line = ask.Default
+	}
+	if len(ask.Items) > 0 {
+		n, err := strconv.Atoi(line)
+		switch {
+		case err == nil && n >= 1 && n <= len(ask.Items):
+			line = ask.Items[n-1]
+		case ask.AddLabel == "" && !contains(ask.Items, line):
+			return "", fmt.Errorf("%q isn't one of the choices", line)
+		}
+	}
+	if ask.Validate != nil {
+		if err := ask.Validate(line); err != nil {
+			return "", err
+		}
+	}
+	return line, nil
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// promptuiPrompter asks with promptui's prompts and menus.
+type promptuiPrompter struct{}
+
+func (promptuiPrompter) Prompt(ask *Ask) (string, error) {
 	if len(ask.Items) == 0 {
 		p := promptui.Prompt{
 			Label:     ask.Label,
@@ -30,9 +131,8 @@ func promptuiRun(ask *Ask) (string, error) {
 			IsConfirm: ask.IsConfirm,
 			Validate:  ask.Validate,
 		}
-		val, err := p.Run()
-		return val, err
-	} else
+		return p.Run()
+	}
 
 	if ask.AddLabel != "" {
 		p := promptui.SelectWithAdd{
@@ -44,7 +144,7 @@ func promptuiRun(ask *Ask) (string, error) {
 		}
 		_, val, err := p.Run()
 		return val, err
-	} 
+	}
 
 	p := promptui.Select{
 		Label: ask.Label,
@@ -54,13 +154,93 @@ func promptuiRun(ask *Ask) (string, error) {
 	return val, err
 }
 
+// linePrompter asks a line at a time, listing the choices by number, and asks
+// again if the answer isn't valid.
+type linePrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newLinePrompter(in io.Reader, out io.Writer) *linePrompter {
+	return &linePrompter{in: bufio.NewReader(in), out: out}
+}
+
+func (p *linePrompter) Prompt(ask *Ask) (string, error) {
+	for {
+		for i, item := range ask.Items {
+			fmt.Fprintf(p.out, "  %d) %s\n", i+1, item)
+		}
+		label := strings.TrimSpace(ask.Label)
+		switch {
+		case ask.IsConfirm && strings.EqualFold(ask.Default, "y"):
+			fmt.Fprintf(p.out, "%s [Y/n] ", label)
+		case ask.IsConfirm:
+			fmt.Fprintf(p.out, "%s [y/N] ", label)
+		case ask.Default != "":
+			fmt.Fprintf(p.out, "%s [%s] ", label, ask.Default)
+		default:
+			fmt.Fprintf(p.out, "%s ", label)
+		}
+
+		line, err := p.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		if err != nil {
+			fmt.Fprintln(p.out)
+			return "", fmt.Errorf("no answer to %q: %w", label, err)
+		}
+		val, err := answer(ask, line)
+		if err == nil || err == promptui.ErrAbort {
+			return val, err
+		}
+		fmt.Fprintf(p.out, "  %v\n", err)
+	}
+}
+
+// scriptPrompter answers the prompts from a script, one line for each in
+// order, for running lift without anyone there. A blank line takes the
+// default.
+type scriptPrompter struct {
+	answers []string
+	asked   int
+	// out is where the prompts and the answers to them are echoed.
+	out io.Writer
+}
+
+func newScriptPrompter(r io.Reader, out io.Writer) (*scriptPrompter, error) {
+	p := &scriptPrompter{out: out}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.answers = append(p.answers, scanner.Text())
+	}
+	return p, scanner.Err()
+}
+
+func (p *scriptPrompter) Prompt(ask *Ask) (string, error) {
+	label := strings.TrimSpace(ask.Label)
+	if p.asked >= len(p.answers) {
+		return "", fmt.Errorf("the script has no answer to %q", label)
+	}
+	line := p.answers[p.asked]
+	p.asked++
+	fmt.Fprintf(p.out, "%s %s\n", label, line)
+
+	val, err := answer(ask, line)
+	if err != nil && err != promptui.ErrAbort {
+		return "", fmt.Errorf("answer %d of the script, %q to %q: %w", p.asked, line, label, err)
+	}
+	return val, err
+}
+
 // Run actually promps the question on the CLI
 func (ask *Ask) Run() (string, error) {
-	return promptuiRun(ask)
+	return prompter.Prompt(ask)
 }
+
 // Confirm prompsthe user to confirm the ask
 func (ask *Ask) Confirm() (bool, error) {
-	_, err := promptuiRun(ask)
+	_, err := ask.Run()
 
 	if err == promptui.ErrAbort {
 		return false, nil
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/awinterman/lifting"
+	"github.com/spf13/cobra"
+)
+
+func backup(cmd *cobra.Command, args []string) {
+	out, err := os.Create(args[0])
+	handle(err)
+
+	manifest, err := lifting.WriteBackup(ctx, backend, out)
+	if err != nil {
+		out.Close()
+		os.Remove(args[0])
+		handle(err)
+	}
+	handle(out.Close())
+	printManifest("backed up", manifest)
+}
+
+func restoreBackup(cmd *cobra.Command, args []string) {
+	in, err := os.Open(args[0])
+	handle(err)
+	defer in.Close()
+
+	manifest, err := lifting.RestoreBackup(ctx, backend, in)
+	handle(err)
+	printManifest("restored", manifest)
+}
+
+func printManifest(did string, manifest lifting.Manifest) {
+	fmt.Printf("%s a version %d backup from %s\n", did, manifest.Version, manifest.CreatedAt.Local().Format("2006-01-02 15:04"))
+	for _, f := range manifest.Files {
+		fmt.Printf("\t%s\t%d\n", f.Name, f.Records)
+	}
+}
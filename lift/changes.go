@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/awinterman/lifting"
+	"github.com/spf13/cobra"
+)
+
+func changes(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	handle(err)
+
+	changes, err := storage.GetChanges(id)
+	handle(err)
+	if len(changes) == 0 {
+		handle(fmt.Errorf("history of repetition %d: %w", id, lifting.ErrNotFound))
+	}
+
+	for _, c := range changes {
+		fmt.Printf("%d\t%s\t%s\t%s\n", c.ID, c.At.Local().Format("2006-01-02 15:04:05"), c.Action, c.Actor)
+		diff, err := c.Diff()
+		handle(err)
+		for _, f := range diff {
+			fmt.Printf("\t%s: %s -> %s\n", f.Field, f.Before, f.After)
+		}
+	}
+	fmt.Printf("`lift revert %d <change>` puts it back how it was after a change\n", id)
+}
+
+func revert(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	handle(err)
+	change, err := strconv.Atoi(args[1])
+	handle(err)
+
+	handle(lifting.Revert(ctx, backend, id, change))
+	fmt.Printf("reverted %d to change %d\n", id, change)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/awinterman/lifting"
+	"github.com/awinterman/lifting/postgres"
+	"github.com/awinterman/lifting/sqlite"
+	"github.com/spf13/cobra"
+)
+
+// Where the database is can be set, most important first, by the --db flag,
+// the LIFT_DB environment variable or the profile picked by the --profile
+// flag, LIFT_PROFILE or the config file.
+var (
+	dbFlag      string
+	profileFlag string
+)
+
+type (
+	// Config is the config file, lift/config.json in the user's config
+	// directory, e.g. ~/.config/lift/config.json.
+	Config struct {
+		// Profile is the profile to use if none is asked for.
+		Profile string `json:"profile,omitempty"`
+		// Profiles are the logs you keep, by name.
+		Profiles map[string]Profile `json:"profiles,omitempty"`
+	}
+
+	// Profile is a log of workouts.
+	Profile struct {
+		// DB is the path of a sqlite database, or a postgres connection
+		// string, either a postgres:// url or key=value pairs. Pairs with
+		// a path in them, like host=/var/run/postgresql, need to be a url.
+		DB string `json:"db"`
+	}
+)
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lift", "config.json"), nil
+}
+
+// loadConfig reads the config file, an empty config if there isn't one.
+func loadConfig() (Config, error) {
+	var config Config
+	path, err := configPath()
+	if err != nil {
+		return config, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// dataDir is where logs are kept if the config doesn't say otherwise,
+// $XDG_DATA_HOME/lift or ~/.local/share/lift.
+func dataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "lift"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "lift"), nil
+}
+
+// expandHome replaces a leading ~ in a path with the home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// resolveDB works out which database to use and the profile it's for. A
+// profile the config doesn't mention gets its own sqlite file in dataDir, the
+// default profile lift.sqlite.
+func resolveDB(config Config) (db, profile string, err error) {
+	profile = config.Profile
+	if p := os.Getenv("LIFT_PROFILE"); p != "" {
+		profile = p
+	}
+	if profileFlag != "" {
+		profile = profileFlag
+	}
+
+	db = config.Profiles[profile].DB
+	if env := os.Getenv("LIFT_DB"); env != "" {
+		db = env
+	}
+	if dbFlag != "" {
+		db = dbFlag
+	}
+	if db != "" {
+		if isPostgres(db) {
+			return db, profile, nil
+		}
+		db, err = expandHome(db)
+		return db, profile, err
+	}
+
+	db, err = defaultDB(profile)
+	return db, profile, err
+}
+
+// defaultDB is the sqlite file in dataDir for a profile the config doesn't
+// mention.
+func defaultDB(profile string) (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	name := "lift.sqlite"
+	if profile != "" {
+		name = profile + ".sqlite"
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// legacyDB is where lift kept the log before it had a default, in whichever
+// directory it was run from.
+const legacyDB = ".lift.sqlite"
+
+// legacyWarning is a warning, if there's a log in legacyDB that lift would
+// pass over for the default one, saying how to carry on with it.
+func legacyWarning(db, profile string) string {
+	if profile != "" {
+		return ""
+	}
+	if def, err := defaultDB(""); err != nil || db != def {
+		return ""
+	}
+	if _, err := os.Stat(legacyDB); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("lift keeps its log in %s now, not %s here. Move it there with\n"+
+		"\tmkdir -p %s && mv %s %s\n"+
+		"or keep using it with --db %s", db, legacyDB, filepath.Dir(db), legacyDB, db, legacyDB)
+}
+
+// keyValue is the start of a postgres key=value connection string.
+var keyValue = regexp.MustCompile(`^\s*[a-z_]+\s*=`)
+
+// isPostgres is true if db is a postgres connection string rather than a path:
+// a postgres:// url, or key=value pairs. Anything with a path separator is a
+// path, even with = in it, e.g. a sqlite url like file:lift.sqlite?_journal=WAL.
+func isPostgres(db string) bool {
+	if strings.HasPrefix(db, "postgres://") || strings.HasPrefix(db, "postgresql://") {
+		return true
+	}
+	return keyValue.MatchString(db) && !strings.ContainsAny(db, `/\`)
+}
+
+// openStorage connects to the database, making the directory for a new
+// sqlite file if need be.
+func openStorage(db string) (lifting.ContextStorage, error) {
+	if isPostgres(db) {
+		return postgres.CreateStorage(db, nil)
+	}
+	if err := os.MkdirAll(filepath.Dir(db), 0755); err != nil {
+		return nil, err
+	}
+	return sqlite.CreateStorage(db, nil)
+}
+
+// open connects to the database for the command about to run, so commands
+// that don't need it, like help, never touch it.
+func open(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	db, profile, err := resolveDB(config)
+	if err != nil {
+		return err
+	}
+	if warning := legacyWarning(db, profile); warning != "" {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	backend, err = openStorage(db)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", db, err)
+	}
+	storage = lifting.AdaptWith(ctx, backend)
+	return nil
+}
+
+// showConfig prints where the config is and which database commands use.
+func showConfig(cmd *cobra.Command, args []string) {
+	path, err := configPath()
+	handle(err)
+	config, err := loadConfig()
+	handle(err)
+	db, profile, err := resolveDB(config)
+	handle(err)
+	warning := legacyWarning(db, profile)
+
+	if profile == "" {
+		profile = "(default)"
+	}
+	fmt.Println("config: ", path)
+	fmt.Println("profile:", profile)
+	fmt.Println("db:     ", db)
+	for name, p := range config.Profiles {
+		fmt.Printf("\t%s\t%s\n", name, p.DB)
+	}
+	if warning != "" {
+		fmt.Println(warning)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsPostgres(t *testing.T) {
+	for db, expected := range map[string]bool{
+		"postgres://coach@club.example.com/lifting": true,
+		"postgresql://localhost/lifting":            true,
+		"dbname=lifting user=coach":                 true,
+		"lift.sqlite":                               false,
+		"~/lifting/home.sqlite":                     false,
+		"file:lift.sqlite?_journal=WAL":             false,
+		"/tmp/a=b.sqlite":                           false,
+	} {
+		if found := isPostgres(db); found != expected {
+			t.Fatal("mimsatch", fmt.Sprintf("expected %#v for %s", expected, db), fmt.Sprintf("found %#v", found))
+		}
+	}
+}
+
+func TestLegacyWarning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	os.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	defer os.Unsetenv("XDG_DATA_HOME")
+
+	db, err := defaultDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warning := legacyWarning(db, ""); warning != "" {
+		t.Fatal("expected no warning without an old log", warning)
+	}
+	if err = ioutil.WriteFile(legacyDB, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if warning := legacyWarning(db, ""); !strings.Contains(warning, "mv .lift.sqlite "+db) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected how to move it to %s", db), fmt.Sprintf("found %#v", warning))
+	}
+	// it's only passed over for the default log.
+	if warning := legacyWarning("other.sqlite", ""); warning != "" {
+		t.Fatal("expected no warning with --db", warning)
+	}
+}
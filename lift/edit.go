@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/awinterman/lifting"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// editFields are the fields `lift edit` sets from its flags, rather than
+	// asking for every one.
+	editFields struct {
+		date, exercise, category, units, elapsed, comment string
+		volume                                            float64
+		sets, weight, effort                              int
+		failure                                           bool
+	}
+	// copyDate is the date a copy is logged on, today if it's empty.
+	copyDate string
+	// rmYes deletes without asking first.
+	rmYes bool
+)
+
+// fieldFlags are the names of the flags editFlags adds.
+var fieldFlags = []string{"date", "exercise", "category", "units", "duration", "comment", "volume", "sets", "weight", "effort", "failure"}
+
+// editFlags adds the flags for setting each of a repetition's fields.
+func editFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&editFields.date, "date", "", "session date, e.g. 2018-12-20")
+	flags.StringVar(&editFields.exercise, "exercise", "", "exercise")
+	flags.StringVar(&editFields.category, "category", "", "workout type")
+	flags.StringVar(&editFields.units, "units", "", "units, e.g. lbs or miles")
+	flags.StringVar(&editFields.elapsed, "duration", "", "how long it took, e.g. 00:24:00")
+	flags.StringVar(&editFields.comment, "comment", "", "comment")
+	flags.Float64Var(&editFields.volume, "volume", 0, "how much, e.g. reps or miles")
+	flags.IntVar(&editFields.sets, "sets", 0, "sets")
+	flags.IntVar(&editFields.weight, "weight", 0, "weight")
+	flags.IntVar(&editFields.effort, "effort", 0, "effort, 0-100")
+	flags.BoolVar(&editFields.failure, "failure", false, "whether it was failed")
+}
+
+// setFields sets the fields whose flags were given, ok false if none were.
+func setFields(cmd *cobra.Command, rep *lifting.Repetition) (ok bool, err error) {
+	flags := cmd.Flags()
+	for _, name := range fieldFlags {
+		ok = ok || flags.Changed(name)
+	}
+	if !ok {
+		return false, nil
+	}
+	if flags.Changed("date") {
+		if rep.SessionDate, err = lifting.ParseSessionDateString(editFields.date); err != nil {
+			return true, err
+		}
+	}
+	if flags.Changed("duration") {
+		if rep.Elapsed, err = civil.ParseTime(editFields.elapsed); err != nil {
+			return true, err
+		}
+	}
+	if flags.Changed("exercise") {
+		rep.Exercise = editFields.exercise
+	}
+	if flags.Changed("category") {
+		rep.Category = editFields.category
+	}
+	if flags.Changed("units") {
+		rep.Units = editFields.units
+	}
+	if flags.Changed("comment") {
+		rep.Comment = editFields.comment
+	}
+	if flags.Changed("volume") {
+		rep.Volume = editFields.volume
+	}
+	if flags.Changed("sets") {
+		rep.Sets = editFields.sets
+	}
+	if flags.Changed("weight") {
+		rep.Weight = editFields.weight
+	}
+	if flags.Changed("effort") {
+		rep.Effort = editFields.effort
+	}
+	if flags.Changed("failure") {
+		rep.Failure = editFields.failure
+	}
+	return true, rep.Validate()
+}
+
+// edit changes a repetition, with the flags or by asking for each field.
+func edit(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	handle(err)
+	rep, err := storage.GetByID(id)
+	handle(err)
+
+	set, err := setFields(cmd, rep)
+	handle(err)
+	if !set {
+		handle(askRepetition(rep))
+	}
+	handle(storage.Load([]lifting.Repetition{*rep}))
+	fmt.Printf("saved %d, `lift changes %d` shows how to undo it\n", id, id)
+}
+
+// copyRepetition logs a repetition again, on another day.
+func copyRepetition(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	handle(err)
+	rep, err := storage.GetByID(id)
+	handle(err)
+
+	// nil it so it's stored as a new one.
+	rep.ID = nil
+	rep.ClientID = ""
+	rep.SessionDate = civil.DateOf(time.Now())
+	if copyDate != "" {
+		rep.SessionDate, err = lifting.ParseSessionDateString(copyDate)
+		handle(err)
+	}
+	reps := []lifting.Repetition{*rep}
+	handle(storage.Load(reps))
+	fmt.Printf("copied %d to %d on %s\n", id, *reps[0].ID, rep.SessionDate)
+}
+
+// rm moves repetitions to the trash, once it's confirmed.
+func rm(cmd *cobra.Command, args []string) {
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		handle(err)
+		ids[i] = id
+	}
+
+	for _, id := range ids {
+		rep, err := storage.GetByID(id)
+		handle(err)
+		if !rmYes {
+			confirm := Ask{Label: fmt.Sprintf("Delete %s", describe(*rep)), IsConfirm: true}
+			ok, err := confirm.Confirm()
+			handle(err)
+			if !ok {
+				fmt.Println("kept", id)
+				continue
+			}
+		}
+		handle(storage.Delete(id))
+		fmt.Printf("moved %d to the trash, `lift trash restore %d` to undo\n", id, id)
+	}
+}
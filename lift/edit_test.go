@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/civil"
+	"github.com/awinterman/lifting"
+)
+
+// run runs the subcommand args name with its flags, but without opening
+// storage, so it uses whatever the test put there.
+func run(t *testing.T, args ...string) {
+	cmd, rest, err := rootCommand().Find(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.ParseFlags(rest); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Run(cmd, cmd.Flags().Args())
+}
+
+// squat logs a squat to edit, returning its id.
+func squat(t *testing.T) int {
+	reps := []lifting.Repetition{{
+		Exercise:    "squat",
+		Category:    "strength",
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+		Units:       "lbs",
+		Volume:      5,
+		Weight:      225,
+		Effort:      70,
+		Comment:     "felt good",
+	}}
+	if err := storage.Load(reps); err != nil {
+		t.Fatal(err)
+	}
+	return *reps[0].ID
+}
+
+func TestSetFields(t *testing.T) {
+	for _, test := range []struct {
+		flags []string
+		set   bool
+	}{
+		{nil, false},
+		{[]string{"--weight", "245"}, true},
+		// it's set even though it's the default, to be able to unset it.
+		{[]string{"--failure=false"}, true},
+		{[]string{"--comment", ""}, true},
+	} {
+		cmd, _, err := rootCommand().Find([]string{"edit"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cmd.ParseFlags(test.flags); err != nil {
+			t.Fatal(err)
+		}
+		rep := lifting.Repetition{Exercise: "squat", SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20}, Comment: "felt good"}
+		set, err := setFields(cmd, &rep)
+		if err != nil {
+			t.Fatal(test.flags, err)
+		}
+		if set != test.set {
+			t.Fatal("mimsatch", fmt.Sprintf("expected %#v for %v", test.set, test.flags), fmt.Sprintf("found %#v", set))
+		}
+	}
+
+	cmd, _, _ := rootCommand().Find([]string{"edit"})
+	if err := cmd.ParseFlags([]string{"--effort", "101"}); err != nil {
+		t.Fatal(err)
+	}
+	rep := lifting.Repetition{Exercise: "squat", SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20}}
+	if set, err := setFields(cmd, &rep); !set || err == nil {
+		t.Fatal("expected the effort to be invalid", set, err)
+	}
+}
+
+func TestEditKeepsOtherFields(t *testing.T) {
+	useMemory(t)
+	id := squat(t)
+	before, err := storage.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, "edit", fmt.Sprint(id), "--weight", "245", "--comment", "")
+
+	after, err := storage.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := *before
+	expected.Weight, expected.Comment = 245, ""
+	expected.ID, expected.UpdatedAt, expected.Seq = after.ID, after.UpdatedAt, after.Seq
+	if *after != expected {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", expected), fmt.Sprintf("found %#v", *after))
+	}
+}
+
+func TestCopyDate(t *testing.T) {
+	useMemory(t)
+	id := squat(t)
+
+	run(t, "copy", fmt.Sprint(id), "--date", "2018-12-27")
+
+	reps := logged(t)
+	if len(reps) != 2 {
+		t.Fatal("expected the original and the copy", reps)
+	}
+	var copied lifting.Repetition
+	for _, r := range reps {
+		if *r.ID != id {
+			copied = r
+		}
+	}
+	if copied.SessionDate != (civil.Date{Year: 2018, Month: 12, Day: 27}) || copied.Exercise != "squat" || copied.Weight != 225 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "a squat at 225 on 2018-12-27"), fmt.Sprintf("found %#v", copied))
+	}
+}
+
+func TestRm(t *testing.T) {
+	useMemory(t)
+	kept, deleted := squat(t), squat(t)
+
+	answers(t, "n")
+	run(t, "rm", fmt.Sprint(kept))
+	run(t, "rm", "--yes", fmt.Sprint(deleted))
+
+	reps := logged(t)
+	if len(reps) != 1 || *reps[0].ID != kept {
+		t.Fatal("mimsatch", fmt.Sprintf("expected only %#v", kept), fmt.Sprintf("found %#v", reps))
+	}
+	trash, err := storage.GetTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || *trash[0].ID != deleted {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v in the trash", deleted), fmt.Sprintf("found %#v", trash))
+	}
+}
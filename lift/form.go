@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+
+	"cloud.google.com/go/civil"
+	"github.com/awinterman/lifting"
+)
+
+// askRepetition prompts for each of the repetition's fields, pre-filled with
+// what it already has, and checks it can be stored.
+func askRepetition(rep *lifting.Repetition) error {
+	var err error
+	fields := []struct {
+		ask Ask
+		set func(string) error
+	}{
+		{Ask{Label: "Date: ", Default: rep.SessionDate.String(), Validate: validateDate}, func(s string) error {
+			rep.SessionDate, err = lifting.ParseSessionDateString(s)
+			return err
+		}},
+		{Ask{Label: "Workout Type: ", Default: rep.Category}, func(s string) error {
+			rep.Category = s
+			return nil
+		}},
+		{Ask{Label: "Exercise: ", Default: rep.Exercise}, func(s string) error {
+			rep.Exercise = s
+			return nil
+		}},
+		{Ask{Label: "Units: ", Default: rep.Units}, func(s string) error {
+			rep.Units = s
+			return nil
+		}},
+		{Ask{Label: "Volume: ", Default: strconv.FormatFloat(rep.Volume, 'f', -1, 64), Validate: validateFloat}, func(s string) error {
+			rep.Volume, err = strconv.ParseFloat(s, 64)
+			return err
+		}},
+		{Ask{Label: "Sets: ", Default: strconv.Itoa(rep.Sets), Validate: validateInt}, func(s string) error {
+			rep.Sets, err = strconv.Atoi(s)
+			return err
+		}},
+		{Ask{Label: "Weight: ", Default: strconv.Itoa(rep.Weight), Validate: validateInt}, func(s string) error {
+			rep.Weight, err = strconv.Atoi(s)
+			return err
+		}},
+		{Ask{Label: "Duration: ", Default: rep.Elapsed.String(), Validate: validateDuration}, func(s string) error {
+			rep.Elapsed, err = civil.ParseTime(s)
+			return err
+		}},
+		{Ask{Label: "Effort [0-100]: ", Default: strconv.Itoa(rep.Effort), Validate: validateEffort}, func(s string) error {
+			rep.Effort, err = strconv.Atoi(s)
+			return err
+		}},
+		{Ask{Label: "Failure [true/false]: ", Default: strconv.FormatBool(rep.Failure), Validate: validateBool}, func(s string) error {
+			rep.Failure, err = strconv.ParseBool(s)
+			return err
+		}},
+		{Ask{Label: "Comment: ", Default: rep.Comment}, func(s string) error {
+			rep.Comment = s
+			return nil
+		}},
+	}
+
+	for _, field := range fields {
+		field.ask.AllowEdit = true
+		answer, err := field.ask.Run()
+		if err != nil {
+			return err
+		}
+		if err = field.set(answer); err != nil {
+			return err
+		}
+	}
+	return rep.Validate()
+}
@@ -9,14 +9,46 @@ import (
 )
 
 func history(cmd *cobra.Command, args []string) {
-	rs, err := storage.GetLast(100, 0)
+	result, err := storage.GetLast(100, historyCursor)
+	handle(err)
+	rs := result.Repetitions
 
-	if err != nil {
-		panic(err)
+	for _, r := range rs {
+		if pace := r.Pace(); pace > 0 {
+			fmt.Println(r, fmt.Sprintf("%s/%s", pace, r.Units))
+		} else {
+			fmt.Println(r)
+		}
 	}
 
-	for _, r := range rs {
-		fmt.Println(r)
+	if historyUnits != "" {
+		printDistance(rs, historyUnits)
+	}
+
+	if result.Next != "" {
+		fmt.Printf("\nearlier: --cursor %s\n", result.Next)
+	}
+}
+
+var (
+	// historyUnits, if set, has history summarize distance work in those units.
+	historyUnits string
+	// historyCursor picks up where a previous page of history left off.
+	historyCursor string
+)
+
+func printDistance(rs []lifting.Repetition, units string) {
+	analytics, err := lifting.AnalyzeDistance(rs, "", units)
+	handle(err)
+
+	fmt.Printf("\nweekly %s\n", units)
+	for _, w := range analytics.Weeks {
+		fmt.Printf("%s\t%.1f\tlong run %.1f (%.0f%%)\n", w.Week, w.Distance, w.LongRun, w.LongRunPercent())
+	}
+
+	fmt.Println("\nbest efforts")
+	for _, e := range analytics.BestEfforts {
+		fmt.Printf("%s\t%s\t%s\t%s\n", e.Exercise, e.Distance.Name, e.Time, e.Repetition.SessionDate)
 	}
 }
 
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/awinterman/lifting"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importCategory string
+	importUnits    string
+)
+
+func importActivity(cmd *cobra.Command, args []string) {
+	for _, filename := range args {
+		format, err := lifting.ActivityFormat(filename)
+		handle(err)
+
+		data, err := ioutil.ReadFile(filename)
+		handle(err)
+
+		rep, err := lifting.ImportActivity(ctx, backend, format, data, importCategory, importUnits)
+		handle(err)
+
+		fmt.Printf("%d: %s %s %.2f %s in %s (%s)\n",
+			*rep.ID, rep.SessionDate, rep.Exercise, rep.Volume, rep.Units, rep.Elapsed, rep.Comment)
+	}
+}
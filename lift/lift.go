@@ -1,29 +1,257 @@
 package main
 
 import (
-	"github.com/awinterman/lifting/sqlite"
+	"context"
+	"time"
+
+	"github.com/awinterman/lifting"
 	"github.com/spf13/cobra"
 )
 
-var storage, err = sqlite.CreateStorage(".lift.sqlite", nil)
+// backend is the database, opened before a command that needs it runs, see
+// open.
+var backend lifting.ContextStorage
+
+// ctx says who is making changes from the command line, for the change log.
+var ctx = lifting.WithActor(context.Background(), "lift ("+username()+")")
+
+// storage is the backend for commands that don't need a context.
+var storage lifting.Storage
 
 func main() {
-	if (err != nil) {
-		panic(err)
+	handle(rootCommand().Execute())
+}
+
+// withoutStorage are the commands cobra adds that never touch the database,
+// nor do any commands under them.
+var withoutStorage = []string{"help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd}
+
+// needsStorage is false for a command that doesn't use the database, so it
+// isn't opened, or made, just for help.
+func needsStorage(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if contains(withoutStorage, c.Name()) {
+			return false
+		}
 	}
-	var root = &cobra.Command{Use: "lift", Short: "Log, view, or edit workouts"}
+	return true
+}
+
+// rootCommand is lift and all its commands.
+func rootCommand() *cobra.Command {
+	var root = &cobra.Command{
+		Use:   "lift",
+		Short: "Log, view, or edit workouts",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !needsStorage(cmd) {
+				return nil
+			}
+			if err := choosePrompter(); err != nil {
+				return err
+			}
+			return open(cmd, args)
+		},
+		// handle explains what went wrong.
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&dbFlag, "db", "", "sqlite file or postgres connection string to use, overrides LIFT_DB and the profile")
+	root.PersistentFlags().StringVar(&profileFlag, "profile", "", "which log in the config file to use, overrides LIFT_PROFILE")
+	root.PersistentFlags().StringVar(&promptsFlag, "prompts", "auto", "how to ask questions, promptui, plain for a line at a time, or auto for promptui on a terminal")
+	root.PersistentFlags().StringVar(&answersFlag, "answers", "", "file of answers to the questions, one a line, instead of asking")
 	var add = &cobra.Command{
 		Use:   "add",
 		Run:   logWorkout,
 		Short: "Log a workout",
 	}
+	add.Flags().BoolVar(&addSession, "session", false, "time the rest between sets and keep a running total of the session")
+	add.Flags().DurationVar(&addRest, "rest", 2*time.Minute, "how long to rest between sets in a session")
 	var history = &cobra.Command{
 		Use:   "history",
 		Run:   history,
 		Short: "View recent workouts",
 	}
+	history.Flags().StringVar(&historyCursor, "cursor", "", "carry on from an earlier page of history")
+	history.Flags().StringVar(&historyUnits, "distance", "", "summarize weekly distance and best efforts in these units, e.g. miles")
+
+	var importActivityCmd = &cobra.Command{
+		Use:   "import-activity file.gpx|file.tcx...",
+		Run:   importActivity,
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Log runs and rides from GPX or TCX track files",
+	}
+	importActivityCmd.Flags().StringVar(&importCategory, "category", "aerobic", "category to log the activity under")
+	importActivityCmd.Flags().StringVar(&importUnits, "units", "miles", "distance units, miles or km")
+
+	var weighCmd = &cobra.Command{
+		Use:   "weigh weight [date]",
+		Run:   weigh,
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "Log your bodyweight",
+	}
+	weighCmd.Flags().StringVar(&weighUnits, "units", "lbs", "units of the weight, lbs or kg")
+
+	var measureCmd = &cobra.Command{
+		Use:   "measure kind value [date]",
+		Run:   measure,
+		Args:  cobra.RangeArgs(2, 3),
+		Short: "Log a body measurement, e.g. body fat, a circumference or sleep",
+	}
+	measureCmd.Flags().StringVar(&measureUnits, "units", "", "units of the measurement, e.g. %, in or hours")
+	measureCmd.Flags().StringVar(&measureSite, "site", "", "where a circumference was taken, e.g. waist")
+
+	var measurementsCmd = &cobra.Command{
+		Use:   "measurements [kind]",
+		Run:   measurements,
+		Args:  cobra.MaximumNArgs(1),
+		Short: "View recent body measurements with a moving average, bodyweight by default",
+	}
+	measurementsCmd.Flags().IntVar(&measureDays, "days", 90, "how many days back to look")
+	measurementsCmd.Flags().IntVar(&measureSmoothing, "smoothing", 7, "days to average over")
+
+	var scoreCmd = &cobra.Command{
+		Use:   "score",
+		Run:   score,
+		Short: "Score your best squat, bench and deadlift total with Wilks, DOTS and IPF GL",
+	}
+	scoreCmd.Flags().StringVar(&scoreSex, "sex", "", "male or female, needed for the scores")
+	scoreCmd.Flags().IntVar(&scoreWindow, "window", 90, "days to look for your best lifts in")
+	scoreCmd.Flags().IntVar(&scoreHistory, "history", 0, "also show how your score changed over this many days")
+
+	var searchCmd = &cobra.Command{
+		Use:   "search [words in the comment...]",
+		Run:   search,
+		Short: "Search workouts by comment, exercise, category, effort and weight",
+	}
+	searchCmd.Flags().StringSliceVar(&searchQuery.Exercises, "exercise", nil, "only these exercises")
+	searchCmd.Flags().StringSliceVar(&searchQuery.Categories, "category", nil, "only these categories")
+	searchCmd.Flags().StringSliceVar(&searchQuery.Units, "units", nil, "only these units")
+	searchCmd.Flags().IntVar(&searchQuery.MinEffort, "min-effort", 0, "lowest effort to include")
+	searchCmd.Flags().IntVar(&searchQuery.MaxEffort, "max-effort", 0, "highest effort to include")
+	searchCmd.Flags().IntVar(&searchQuery.MinWeight, "min-weight", 0, "lightest weight to include")
+	searchCmd.Flags().IntVar(&searchQuery.MaxWeight, "max-weight", 0, "heaviest weight to include")
+	searchCmd.Flags().BoolVar(&searchQuery.FailureOnly, "failure", false, "only sets you failed")
+	searchCmd.Flags().StringVar(&searchSort, "sort", "newest", "newest, oldest, heaviest or hardest")
+	searchCmd.Flags().IntVar(&searchQuery.Count, "count", 20, "how many to show")
+	searchCmd.Flags().StringVar(&searchQuery.Cursor, "cursor", "", "carry on from a previous search")
+
+	var trashCmd = &cobra.Command{
+		Use:   "trash",
+		Short: "List, restore or purge deleted workouts",
+	}
+	var trashListCmd = &cobra.Command{
+		Use:   "list",
+		Run:   trashList,
+		Args:  cobra.NoArgs,
+		Short: "List deleted workouts, most recently deleted first",
+	}
+	var trashRestoreCmd = &cobra.Command{
+		Use:   "restore id...",
+		Run:   trashRestore,
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Take deleted workouts back out of the trash",
+	}
+	var trashPurgeCmd = &cobra.Command{
+		Use:   "purge",
+		Run:   trashPurge,
+		Args:  cobra.NoArgs,
+		Short: "Permanently remove workouts that have been in the trash a while",
+	}
+	trashPurgeCmd.Flags().DurationVar(&trashOlderThan, "older-than", lifting.DefaultRetention, "only purge what was deleted longer ago than this, 0 empties the trash")
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashPurgeCmd)
+
+	var changesCmd = &cobra.Command{
+		Use:   "changes id",
+		Run:   changes,
+		Args:  cobra.ExactArgs(1),
+		Short: "View the history of changes to a workout",
+	}
+	var revertCmd = &cobra.Command{
+		Use:   "revert id change",
+		Run:   revert,
+		Args:  cobra.ExactArgs(2),
+		Short: "Put a workout back how it was after one of its changes",
+	}
+
+	var editCmd = &cobra.Command{
+		Use:   "edit id",
+		Run:   edit,
+		Args:  cobra.ExactArgs(1),
+		Short: "Change a workout, with the flags or by answering a prompt for each field",
+	}
+	editFlags(editCmd)
+	var copyCmd = &cobra.Command{
+		Use:   "copy id",
+		Run:   copyRepetition,
+		Args:  cobra.ExactArgs(1),
+		Short: "Log a workout again",
+	}
+	copyCmd.Flags().StringVar(&copyDate, "date", "", "date to log the copy on, today by default")
+	var rmCmd = &cobra.Command{
+		Use:   "rm id...",
+		Run:   rm,
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Move workouts to the trash",
+	}
+	rmCmd.Flags().BoolVarP(&rmYes, "yes", "y", false, "don't ask before deleting each one")
+
+	var backupCmd = &cobra.Command{
+		Use:   "backup out.tar.gz",
+		Run:   backup,
+		Args:  cobra.ExactArgs(1),
+		Short: "Back up every workout, track and measurement to an archive",
+	}
+	var restoreCmd = &cobra.Command{
+		Use:   "restore in.tar.gz",
+		Run:   restoreBackup,
+		Args:  cobra.ExactArgs(1),
+		Short: "Restore a backup into an empty log",
+	}
+
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Run:   serve,
+		Args:  cobra.NoArgs,
+		Short: "Run the web app",
+	}
+	serveFlags(serveCmd)
+
+	var tuiCmd = &cobra.Command{
+		Use:   "tui",
+		Run:   tui,
+		Args:  cobra.NoArgs,
+		Short: "Full screen dashboard of today's session, your history and one rep max trends",
+	}
+	tuiCmd.Flags().IntVar(&tuiHistory, "count", 200, "how many of the latest workouts to show")
+	tuiCmd.Flags().IntVar(&tuiDays, "days", 180, "how many days back the one rep max trends go")
+
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Run:   showConfig,
+		Args:  cobra.NoArgs,
+		Short: "Show where the config file is and which database lift uses",
+		// it only reads the config.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
 
 	root.AddCommand(add)
 	root.AddCommand(history)
-	root.Execute()
+	root.AddCommand(importActivityCmd)
+	root.AddCommand(weighCmd)
+	root.AddCommand(measureCmd)
+	root.AddCommand(measurementsCmd)
+	root.AddCommand(scoreCmd)
+	root.AddCommand(searchCmd)
+	root.AddCommand(editCmd)
+	root.AddCommand(copyCmd)
+	root.AddCommand(rmCmd)
+	root.AddCommand(trashCmd)
+	root.AddCommand(changesCmd)
+	root.AddCommand(revertCmd)
+	root.AddCommand(backupCmd)
+	root.AddCommand(restoreCmd)
+	root.AddCommand(serveCmd)
+	root.AddCommand(tuiCmd)
+	root.AddCommand(configCmd)
+	return root
 }
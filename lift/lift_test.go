@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHelpWithoutStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("XDG_DATA_HOME", dir)
+	defer os.Unsetenv("XDG_DATA_HOME")
+	// nothing is listening on port 1.
+	os.Setenv("LIFT_DB", "postgres://lift@127.0.0.1:1/lifting?sslmode=disable&connect_timeout=1")
+	defer os.Unsetenv("LIFT_DB")
+
+	for _, args := range [][]string{{"help"}, {"help", "add"}, {"completion", "bash"}} {
+		root := rootCommand()
+		root.SetArgs(args)
+		root.SetOut(io.Discard)
+		if err := root.Execute(); err != nil {
+			t.Fatal("expected", args, "not to need the database", err)
+		}
+	}
+
+	root := rootCommand()
+	root.SetArgs([]string{"history"})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected history to need the database")
+	}
+
+	os.Unsetenv("LIFT_DB")
+	root = rootCommand()
+	root.SetArgs([]string{"help"})
+	root.SetOut(io.Discard)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "lift")); !os.IsNotExist(err) {
+		t.Fatal("expected help not to make a log", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/awinterman/lifting"
+	"github.com/spf13/cobra"
+)
+
+var (
+	weighUnits       string
+	measureUnits     string
+	measureSite      string
+	measureDays      int
+	measureSmoothing int
+)
+
+// parseMeasurement reads a value and an optional date from the args.
+func parseMeasurement(kind, units string, args []string) lifting.Measurement {
+	value, err := strconv.ParseFloat(args[0], 64)
+	handle(err)
+
+	date := civil.DateOf(time.Now())
+	if len(args) > 1 {
+		date, err = lifting.ParseSessionDateString(args[1])
+		handle(err)
+	}
+
+	return lifting.Measurement{
+		Kind:  kind,
+		Value: value,
+		Date:  date,
+		Units: units,
+		Site:  measureSite,
+	}
+}
+
+func saveMeasurement(m lifting.Measurement) {
+	err := storage.LoadMeasurements([]lifting.Measurement{m})
+	handle(err)
+	fmt.Printf("%s %s %v %s\n", m.Date, m.Kind, m.Value, m.Units)
+}
+
+func weigh(cmd *cobra.Command, args []string) {
+	saveMeasurement(parseMeasurement(lifting.Bodyweight, weighUnits, args))
+}
+
+func measure(cmd *cobra.Command, args []string) {
+	saveMeasurement(parseMeasurement(args[0], measureUnits, args[1:]))
+}
+
+func measurements(cmd *cobra.Command, args []string) {
+	kind := lifting.Bodyweight
+	if len(args) > 0 {
+		kind = args[0]
+	}
+
+	today := civil.DateOf(time.Now())
+	ms, err := storage.GetMeasurements(kind, today.AddDays(-measureDays), today)
+	handle(err)
+
+	for _, p := range lifting.MovingAverage(ms, measureSmoothing) {
+		fmt.Printf("%s\t%s\t%v\t%.1f\t%s\n", p.Date, p.Site, p.Value, p.Average, p.Units)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/awinterman/lifting"
+)
+
+var (
+	// addSession turns on the rest timer and running summary in `lift add`.
+	addSession bool
+	addRest    time.Duration
+	// countdownTick is how often the countdown is updated.
+	countdownTick = time.Second
+)
+
+// clock formats a duration as minutes:seconds, like a timer.
+func clock(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// countdown counts the rest down on the terminal, ringing the bell when it's
+// up. It's cut short, without the bell, if ctx is done.
+func countdown(ctx context.Context, out io.Writer, rest time.Duration) {
+	tick := time.NewTicker(countdownTick)
+	defer tick.Stop()
+
+	end := time.Now().Add(rest)
+	for left := rest; left > 0; left = time.Until(end) {
+		fmt.Fprintf(out, "\rresting %s, ctrl-c to skip ", clock(left))
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return
+		case <-tick.C:
+		}
+	}
+	fmt.Fprint(out, "\r\arest is up                    \n")
+}
+
+// sessionSummary is the running total of a session, as it's logged.
+type sessionSummary struct {
+	sets    int
+	tonnage map[string]float64
+}
+
+func (s *sessionSummary) add(rep lifting.Repetition) {
+	if s.tonnage == nil {
+		s.tonnage = make(map[string]float64)
+	}
+	s.sets++
+	if tonnage := rep.Tonnage(); tonnage > 0 {
+		s.tonnage[rep.Units] += tonnage
+	}
+}
+
+// String is e.g. "7 sets, 4250 lbs", with the tonnage in each of the units
+// lifted in.
+func (s sessionSummary) String() string {
+	units := make([]string, 0, len(s.tonnage))
+	for u := range s.tonnage {
+		units = append(units, u)
+	}
+	sort.Strings(units)
+	parts := []string{fmt.Sprintf("%d sets", s.sets)}
+	for _, u := range units {
+		parts = append(parts, fmt.Sprintf("%.0f %s", s.tonnage[u], u))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rest runs the rest timer after a set, then waits to be told the next one is
+// starting, returning how long was actually rested.
+func rest(finished time.Time) (time.Duration, error) {
+	// ctrl-c cuts the rest short, rather than stopping lift.
+	skip, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	countdown(skip, os.Stdout, addRest)
+	stop()
+	next := Ask{Label: "Enter to start the next set"}
+	if _, err := next.Run(); err != nil {
+		return 0, err
+	}
+	return time.Since(finished), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/awinterman/lifting"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scoreSex     string
+	scoreWindow  int
+	scoreHistory int
+)
+
+func score(cmd *cobra.Command, args []string) {
+	var (
+		sex lifting.Sex
+		err error
+	)
+	if scoreSex != "" {
+		sex, err = lifting.ParseSex(scoreSex)
+		handle(err)
+	}
+
+	today := civil.DateOf(time.Now())
+	reps, err := storage.GetBetween(today.AddDays(1-scoreWindow-scoreHistory), today)
+	handle(err)
+
+	bw, err := storage.GetMeasurements(lifting.Bodyweight, civil.Date{Year: 1900, Month: 1, Day: 1}, today)
+	handle(err)
+	bodyweights := lifting.NewBodyweights(bw)
+
+	current := lifting.BestTotal(reps, bodyweights, sex, today.AddDays(1-scoreWindow), today)
+	fmt.Printf("best lifts in the last %d days\n", scoreWindow)
+	printTotal(current)
+
+	if scoreHistory > 0 {
+		fmt.Println("\nhistory")
+		first := today.AddDays(1 - scoreHistory)
+		for _, t := range lifting.ScoreHistory(reps, bodyweights, sex, scoreWindow) {
+			if !t.End.Before(first) {
+				printTotal(t)
+			}
+		}
+	}
+}
+
+func printTotal(t lifting.Total) {
+	fmt.Printf("%s\tsquat %.1f\tbench %.1f\tdeadlift %.1f\ttotal %.1fkg",
+		t.End, t.Squat, t.Bench, t.Deadlift, t.Total)
+	if t.Bodyweight > 0 {
+		fmt.Printf("\tbodyweight %.1fkg", t.Bodyweight)
+	}
+	if t.DOTS > 0 {
+		fmt.Printf("\twilks %.2f\tdots %.2f\tipf gl %.2f", t.Wilks, t.DOTS, t.IPFGL)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/awinterman/lifting"
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchQuery lifting.Query
+	searchSort  string
+)
+
+func search(cmd *cobra.Command, args []string) {
+	var err error
+	query := searchQuery
+	query.Text = strings.Join(args, " ")
+	query.Sort, err = lifting.ParseSort(searchSort)
+	handle(err)
+
+	result, err := storage.Search(query)
+	handle(err)
+
+	for _, r := range result.Repetitions {
+		if r.Comment != "" {
+			fmt.Println(r, r.Comment)
+		} else {
+			fmt.Println(r)
+		}
+	}
+
+	if result.Previous != "" {
+		fmt.Printf("\nback: --cursor %s\n", result.Previous)
+	}
+	if result.Next != "" {
+		fmt.Printf("\nmore: --cursor %s\n", result.Next)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/awinterman/lifting"
+	"github.com/spf13/cobra"
+)
+
+// serveConfig is set by the serve command's flags, which default to the
+// LIFT_* environment variables.
+var serveConfig lifting.ServerConfig
+
+// serveFlags adds the serve command's flags, the same ones the web binary
+// has.
+func serveFlags(cmd *cobra.Command) {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	serveConfig.AddFlags(flags)
+	cmd.Flags().AddGoFlagSet(flags)
+}
+
+// serve runs the web app until it's interrupted or sent SIGTERM, then lets
+// the requests in flight finish.
+func serve(cmd *cobra.Command, args []string) {
+	serveConfig.Logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	stop, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	handle(lifting.Serve(stop, backend, serveConfig))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var trashOlderThan time.Duration
+
+func trashList(cmd *cobra.Command, args []string) {
+	trashed, err := storage.GetTrash()
+	handle(err)
+
+	if len(trashed) == 0 {
+		fmt.Println("the trash is empty")
+		return
+	}
+	for _, t := range trashed {
+		fmt.Printf("%d\tdeleted %s\t%v\n", *t.ID, t.DeletedAt.Local().Format("2006-01-02 15:04"), t.Repetition)
+	}
+}
+
+func trashRestore(cmd *cobra.Command, args []string) {
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		handle(err)
+		handle(storage.Restore(id))
+		fmt.Println("restored", id)
+	}
+}
+
+func trashPurge(cmd *cobra.Command, args []string) {
+	purged, err := storage.Purge(time.Now().Add(-trashOlderThan))
+	handle(err)
+	fmt.Printf("permanently deleted %d repetitions\n", purged)
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/awinterman/lifting"
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// tuiHistory is how many of the latest repetitions the dashboard shows.
+	tuiHistory int
+	// tuiDays is how far back the one rep max trends go.
+	tuiDays int
+)
+
+const (
+	// trendsWidth is the width of the pane of one rep max trends, beside the
+	// history when the terminal is wide enough.
+	trendsWidth = 40
+	// sparkWidth is how many days a trend's sparkline shows.
+	sparkWidth = 16
+	keyHelp    = "a add  e edit  c copy  d delete  u undo  r refresh  q quit"
+)
+
+// sparks are the bars of a terminal sparkline, lowest first.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// spark draws the values as a row of bars, scaled between the smallest and
+// the largest.
+func spark(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	bars := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if max > min {
+			level = int((v - min) / (max - min) * float64(len(sparks)-1))
+		}
+		bars[i] = sparks[level]
+	}
+	return string(bars)
+}
+
+// describe is a repetition on one line of the dashboard.
+func describe(r lifting.Repetition) string {
+	var b strings.Builder
+	if r.ID != nil {
+		fmt.Fprintf(&b, "#%d ", *r.ID)
+	}
+	b.WriteString(r.Exercise)
+	switch {
+	case r.IsDistance():
+		fmt.Fprintf(&b, " %g %s", r.Volume, r.Units)
+		if pace := r.Pace(); pace > 0 {
+			fmt.Fprintf(&b, " in %s, %s/%s", r.Elapsed, pace, r.Units)
+		}
+	default:
+		if r.Sets > 1 {
+			fmt.Fprintf(&b, " %dx", r.Sets)
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%g", r.Volume)
+		if r.Weight > 0 {
+			fmt.Fprintf(&b, " @ %d %s", r.Weight, r.Units)
+		} else {
+			fmt.Fprintf(&b, " %s", r.Units)
+		}
+	}
+	if r.Effort > 0 {
+		fmt.Fprintf(&b, " effort %d", r.Effort)
+	}
+	if r.Failure {
+		b.WriteString(" failed")
+	}
+	if r.Rest > 0 {
+		fmt.Fprintf(&b, " after %s rest", clock(r.Rest))
+	}
+	if r.Comment != "" {
+		fmt.Fprintf(&b, " (%s)", r.Comment)
+	}
+	return b.String()
+}
+
+// fit cuts or pads the line to exactly width columns.
+func fit(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return line + strings.Repeat(" ", width-len(runes))
+}
+
+// dashRow is a line of the dashboard's history pane, a heading if it has no
+// repetition.
+type dashRow struct {
+	text string
+	rep  *lifting.Repetition
+}
+
+// dashboard is the state of `lift tui`.
+type dashboard struct {
+	out   io.Writer
+	today civil.Date
+
+	// mu is held while a key is handled, so a redraw after the terminal is
+	// resized doesn't cross it.
+	mu     sync.Mutex
+	paused bool
+	raw    *readline.State
+
+	rows   []dashRow
+	trends []string
+	// selected is the row the keys act on, top the first row on screen.
+	selected, top int
+	status        string
+	// deleted is the last repetition deleted, for undo.
+	deleted *int
+}
+
+// load reads today's session, the history and the trends from the storage,
+// keeping the same repetition selected if it's still there.
+func (d *dashboard) load() error {
+	result, err := storage.GetLast(tuiHistory, "")
+	if err != nil {
+		return err
+	}
+	recent, err := storage.GetBetween(d.today.AddDays(-tuiDays), d.today)
+	if err != nil {
+		return err
+	}
+
+	var selectedID int
+	if rep := d.selectedRep(); rep != nil && rep.ID != nil {
+		selectedID = *rep.ID
+	}
+
+	d.rows = d.rows[:0]
+	var (
+		session sessionSummary
+		today   []lifting.Repetition
+	)
+	for _, r := range result.Repetitions {
+		if r.SessionDate == d.today {
+			session.add(r)
+			today = append(today, r)
+		}
+	}
+	d.rows = append(d.rows, dashRow{text: "today, " + session.String()})
+	for i := range today {
+		d.rows = append(d.rows, dashRow{text: "  " + describe(today[i]), rep: &today[i]})
+	}
+
+	d.rows = append(d.rows, dashRow{}, dashRow{text: "history"})
+	for _, g := range lifting.GroupByDate(result.Repetitions) {
+		if g.Date == d.today {
+			continue
+		}
+		d.rows = append(d.rows, dashRow{text: fmt.Sprintf("%s %s", g.Date, g.Weekday())})
+		sort.Slice(g.Categories, func(i, j int) bool {
+			return g.Categories[i].Category < g.Categories[j].Category
+		})
+		for _, c := range g.Categories {
+			d.rows = append(d.rows, dashRow{text: "  " + c.Category})
+			for i := range c.Reps {
+				d.rows = append(d.rows, dashRow{text: "    " + describe(c.Reps[i]), rep: &c.Reps[i]})
+			}
+		}
+	}
+
+	d.selected = 0
+	for i, row := range d.rows {
+		if row.rep == nil {
+			continue
+		}
+		if d.rows[d.selected].rep == nil || (row.rep.ID != nil && *row.rep.ID == selectedID) {
+			d.selected = i
+		}
+	}
+
+	trends := lifting.E1RMTrend(recent)
+	exercises := make([]string, 0, len(trends))
+	for exercise := range trends {
+		exercises = append(exercises, exercise)
+	}
+	sort.Strings(exercises)
+	d.trends = []string{fmt.Sprintf("estimated 1RM, last %d days", tuiDays)}
+	for _, exercise := range exercises {
+		points := trends[exercise]
+		if len(points) > sparkWidth {
+			points = points[len(points)-sparkWidth:]
+		}
+		values := make([]float64, len(points))
+		for i, p := range points {
+			values[i] = p.E1RM
+		}
+		last := points[len(points)-1]
+		d.trends = append(d.trends, fmt.Sprintf("%-12s %s %.0f %s",
+			fit(exercise, 12), fit(spark(values), sparkWidth), last.E1RM, last.Units))
+	}
+	return nil
+}
+
+func (d *dashboard) selectedRep() *lifting.Repetition {
+	if d.selected < 0 || d.selected >= len(d.rows) {
+		return nil
+	}
+	return d.rows[d.selected].rep
+}
+
+// move selects the next repetition up or down, by step rows.
+func (d *dashboard) move(step int) {
+	for i := d.selected + step; i >= 0 && i < len(d.rows); i += step {
+		if d.rows[i].rep != nil {
+			d.selected = i
+			return
+		}
+	}
+}
+
+func (d *dashboard) redraw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.paused {
+		d.draw()
+	}
+}
+
+// draw paints the whole screen: the keys along the top, the session and
+// history on the left, the trends on the right, or below if it's narrow, and
+// the status along the bottom.
+func (d *dashboard) draw() {
+	width, height, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	left, trends := width, d.trends
+	body := height - 2
+	beside := width >= 2*trendsWidth+20
+	if beside {
+		left = width - trendsWidth - 1
+	} else {
+		shown := len(trends)
+		if shown > body/3 {
+			shown = body / 3
+		}
+		trends = trends[:shown]
+		body -= len(trends)
+	}
+	if body < 1 {
+		body = 1
+	}
+
+	// scroll to keep the selection on screen.
+	if d.selected < d.top {
+		d.top = d.selected
+	}
+	if d.selected >= d.top+body {
+		d.top = d.selected - body + 1
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	fmt.Fprintf(&b, "\x1b[1m%s\x1b[0m\r\n", fit("lift  "+keyHelp, width))
+	for line := 0; line < body; line++ {
+		i := d.top + line
+		text := ""
+		if i < len(d.rows) {
+			text = d.rows[i].text
+		}
+		if i == d.selected && d.rows[i].rep != nil {
+			fmt.Fprintf(&b, "\x1b[7m%s\x1b[0m", fit(text, left))
+		} else {
+			b.WriteString(fit(text, left))
+		}
+		if beside {
+			b.WriteString("│")
+			if line < len(trends) {
+				b.WriteString(fit(trends[line], trendsWidth))
+			} else {
+				b.WriteString(strings.Repeat(" ", trendsWidth))
+			}
+		}
+		b.WriteString("\r\n")
+	}
+	if !beside {
+		for _, line := range trends {
+			b.WriteString(fit(line, width) + "\r\n")
+		}
+	}
+	b.WriteString(fit(d.status, width))
+	io.WriteString(d.out, b.String())
+}
+
+// start takes over the terminal, with mu held.
+func (d *dashboard) start() error {
+	raw, err := readline.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	d.raw = raw
+	d.paused = false
+	// the prompts take the resize signal over while they run.
+	readline.DefaultOnWidthChanged(d.redraw)
+	io.WriteString(d.out, "\x1b[?1049h\x1b[?25l\x1b[2J")
+	d.draw()
+	return nil
+}
+
+// stop gives the terminal back, for the prompts or for good, with mu held.
+func (d *dashboard) stop() {
+	d.paused = true
+	io.WriteString(d.out, "\x1b[?25h\x1b[?1049l")
+	readline.Restore(int(os.Stdin.Fd()), d.raw)
+}
+
+// reload reads everything again after a change, saying done in the status
+// line, or why it couldn't.
+func (d *dashboard) reload(done string) {
+	d.status = done
+	if err := d.load(); err != nil {
+		d.status = fmt.Sprintf("%s, but couldn't refresh: %v", done, err)
+	}
+}
+
+// save asks for the repetition's fields and stores it, saying how it went in
+// the status line. It's only an error if the dashboard can't be put back.
+func (d *dashboard) save(rep lifting.Repetition, done string) error {
+	d.stop()
+	err := askRepetition(&rep)
+	if err == nil {
+		err = storage.Load([]lifting.Repetition{rep})
+	}
+	if err == nil {
+		d.reload(done)
+	} else {
+		d.status = "not saved: " + err.Error()
+	}
+	return d.start()
+}
+
+// key does what the key pressed says, done if it says to quit. What goes
+// wrong with the storage is shown in the status line, the error is only for
+// when the dashboard can't carry on.
+func (d *dashboard) key(in []byte) (done bool, err error) {
+	d.status = ""
+	rep := d.selectedRep()
+	switch string(in) {
+	case "q", "\x03", "\x04":
+		return true, nil
+	case "j", "\x1b[B", "\x1bOB":
+		d.move(1)
+	case "k", "\x1b[A", "\x1bOA":
+		d.move(-1)
+	case "\x1b[6~", " ":
+		for i := 0; i < 10; i++ {
+			d.move(1)
+		}
+	case "\x1b[5~":
+		for i := 0; i < 10; i++ {
+			d.move(-1)
+		}
+	case "r":
+		d.reload("refreshed")
+	case "a":
+		add := lifting.Repetition{SessionDate: d.today, Sets: 1}
+		if rep != nil {
+			add.Category, add.Exercise, add.Units = rep.Category, rep.Exercise, rep.Units
+		}
+		err = d.save(add, "added")
+	case "e":
+		if rep == nil {
+			d.status = "nothing to edit"
+			break
+		}
+		err = d.save(*rep, fmt.Sprintf("edited #%d", *rep.ID))
+	case "c":
+		if rep == nil {
+			d.status = "nothing to copy"
+			break
+		}
+		copied := *rep
+		// nil it so it's stored as a new one.
+		copied.ID = nil
+		copied.ClientID = ""
+		copied.SessionDate = d.today
+		err = d.save(copied, fmt.Sprintf("copied #%d", *rep.ID))
+	case "d":
+		if rep == nil {
+			d.status = "nothing to delete"
+			break
+		}
+		d.status = fmt.Sprintf("delete %s? y/n", describe(*rep))
+		d.draw()
+		answer := make([]byte, 8)
+		n, _ := os.Stdin.Read(answer)
+		if n == 0 || (answer[0] != 'y' && answer[0] != 'Y') {
+			d.status = "kept it"
+			break
+		}
+		if err := storage.Delete(*rep.ID); err != nil {
+			d.status = "not deleted: " + err.Error()
+			break
+		}
+		id := *rep.ID
+		d.deleted = &id
+		d.reload(fmt.Sprintf("moved #%d to the trash, u to undo", id))
+	case "u":
+		if d.deleted == nil {
+			d.status = "nothing to undo"
+			break
+		}
+		if err := storage.Restore(*d.deleted); err != nil {
+			d.status = "not restored: " + err.Error()
+			break
+		}
+		restored := *d.deleted
+		d.deleted = nil
+		d.reload(fmt.Sprintf("restored #%d", restored))
+	}
+	return false, err
+}
+
+func tui(cmd *cobra.Command, args []string) {
+	if !readline.IsTerminal(int(os.Stdin.Fd())) || !readline.IsTerminal(int(os.Stdout.Fd())) {
+		handle(fmt.Errorf("lift tui needs a terminal"))
+	}
+	d := &dashboard{out: os.Stdout, today: civil.DateOf(time.Now())}
+	handle(d.load())
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	handle(d.start())
+
+	in := make([]byte, 16)
+	for {
+		d.mu.Unlock()
+		n, err := os.Stdin.Read(in)
+		d.mu.Lock()
+		done := false
+		if err == nil {
+			done, err = d.key(in[:n])
+		}
+		if done || err != nil {
+			d.stop()
+			handle(err)
+			return
+		}
+		d.draw()
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/civil"
+)
+
+func TestDashboardStorageErrors(t *testing.T) {
+	useMemory(t)
+	d := &dashboard{out: io.Discard, today: civil.Date{Year: 2018, Month: 12, Day: 22}}
+	if err := d.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restoring what isn't in the trash fails, but the dashboard carries on.
+	missing := 999
+	d.deleted = &missing
+	done, err := d.key([]byte("u"))
+	if done || err != nil {
+		t.Fatal("expected the dashboard to carry on", done, err)
+	}
+	if !strings.HasPrefix(d.status, "not restored: ") {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "not restored: ..."), fmt.Sprintf("found %#v", d.status))
+	}
+
+	if done, err = d.key([]byte("r")); done || err != nil || d.status != "refreshed" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "refreshed"), fmt.Sprintf("found %#v", d.status), err)
+	}
+}
@@ -2,28 +2,52 @@ package main
 
 import (
 	"cloud.google.com/go/civil"
+	"context"
 	"errors"
+	"fmt"
+	"github.com/awinterman/lifting"
 	"github.com/manifoldco/promptui"
-	"log"
+	"os"
+	"os/user"
 	"strconv"
 )
 
+// handle stops the command if something went wrong, explaining what.
 func handle(err error) {
-	if err != nil {
-		if err == promptui.ErrAbort {
-			log.Panic("aborted", err)
-		}
+	if err == nil {
+		return
+	}
 
-		log.Panic(err)
+	switch {
+	case err == promptui.ErrAbort || err == promptui.ErrInterrupt:
+		fmt.Fprintln(os.Stderr, "aborted")
+	case errors.Is(err, lifting.ErrNotFound):
+		fmt.Fprintf(os.Stderr, "lift: %v, `lift history` lists the IDs\n", err)
+	case errors.Is(err, lifting.ErrConflict):
+		fmt.Fprintf(os.Stderr, "lift: %v, it clashes with something already logged\n", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Fprintln(os.Stderr, "lift: the database took too long to answer")
+	default:
+		fmt.Fprintf(os.Stderr, "lift: %v\n", err)
 	}
+	os.Exit(1)
 }
 
+// validateInt checks for a count that can't go below zero, like sets or weight.
 func validateInt(arg string) error {
-	_, err := strconv.Atoi(arg)
+	i, err := strconv.Atoi(arg)
 	if err != nil {
 		return err
 	}
-	return nil
+	return lifting.ValidateAmount(float64(i))
+}
+
+func validateFloat(arg string) error {
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return err
+	}
+	return lifting.ValidateAmount(f)
 }
 
 func validateEffort(effort string) error {
@@ -31,15 +55,31 @@ func validateEffort(effort string) error {
 	if err != nil {
 		return err
 	}
+	return lifting.ValidateEffort(i)
+}
 
-	if i < 0 || i > 100 {
-		return errors.New("Must be between 0 and 100")
+func validateDuration(duration string) error {
+	t, err := civil.ParseTime(duration)
+	if err != nil {
+		return err
+	}
+	return lifting.ValidateElapsed(t)
+}
+
+// username is who's logged in, for the change log.
+func username() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
 	}
+	return os.Getenv("USER")
+}
 
-	return nil
+func validateBool(b string) error {
+	_, err := strconv.ParseBool(b)
+	return err
 }
 
-func validateDuration(duration string) error {
-	_, err := civil.ParseTime(duration)
+func validateDate(date string) error {
+	_, err := lifting.ParseSessionDateString(date)
 	return err
 }
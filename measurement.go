@@ -0,0 +1,286 @@
+package lifting
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/civil"
+)
+
+// The kinds of measurements we know about. Anything else is allowed, these are
+// just the ones the analytics look for.
+const (
+	Bodyweight       = "bodyweight"
+	BodyFat          = "body fat"
+	Circumference    = "circumference"
+	RestingHeartRate = "resting heart rate"
+	Sleep            = "sleep"
+)
+
+// MeasurementKinds lists the known kinds of measurement with their usual units.
+var MeasurementKinds = []struct {
+	Kind, Units string
+}{
+	{Bodyweight, "lbs"},
+	{BodyFat, "%"},
+	{Circumference, "in"},
+	{RestingHeartRate, "bpm"},
+	{Sleep, "hours"},
+}
+
+const (
+	kgPerLb = 0.45359237
+)
+
+type (
+	// Measurement is a reading of something about your body on a day, e.g.
+	// your bodyweight, how much you slept or your waist.
+	Measurement struct {
+		ID *int
+		// What day was the reading taken?
+		Date civil.Date
+		// What was measured, e.g. Bodyweight?
+		Kind string
+		// Where on the body, for circumferences, e.g. waist or arm.
+		Site  string
+		Value float64
+		// lbs, kg, %, in, cm, bpm, hours...
+		Units   string
+		Comment string
+	}
+
+	// MeasurementRow is the SQL database format for a Measurement
+	MeasurementRow struct {
+		ID      *int
+		Date    string `db:"measured_on"`
+		Kind    string
+		Site    sql.NullString
+		Value   float64
+		Units   sql.NullString
+		Comment sql.NullString
+	}
+
+	// MeasurementQuery represents how we pull measurements out of the database.
+	MeasurementQuery struct {
+		Kind       string
+		Start, End string
+	}
+)
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// MeasurementToRow transforms from a measurement to a database row.
+func MeasurementToRow(m Measurement) (MeasurementRow, error) {
+	var nullDate civil.Date
+	if m.Date == nullDate {
+		return MeasurementRow{}, fmt.Errorf("date must be set on measurement %v", m)
+	}
+	if m.Kind == "" {
+		return MeasurementRow{}, fmt.Errorf("kind must be set on measurement %v", m)
+	}
+
+	return MeasurementRow{
+		ID:      m.ID,
+		Date:    m.Date.String(),
+		Kind:    m.Kind,
+		Site:    nullString(m.Site),
+		Value:   m.Value,
+		Units:   nullString(m.Units),
+		Comment: nullString(m.Comment),
+	}, nil
+}
+
+// RowToMeasurement converts from a database row to a measurement.
+func RowToMeasurement(row MeasurementRow) (Measurement, error) {
+	date, err := ParseSessionDateString(row.Date)
+	if err != nil {
+		return Measurement{}, err
+	}
+
+	return Measurement{
+		ID:      row.ID,
+		Date:    date,
+		Kind:    row.Kind,
+		Site:    row.Site.String,
+		Value:   row.Value,
+		Units:   row.Units.String,
+		Comment: row.Comment.String,
+	}, nil
+}
+
+// massIn converts a mass between lbs and kg.
+func massIn(value float64, from, to string) (float64, error) {
+	toKg := func(units string) (float64, error) {
+		switch strings.ToLower(units) {
+		case "kg", "kgs", "kilograms":
+			return 1, nil
+		case "lbs", "lb", "pounds", "":
+			return kgPerLb, nil
+		}
+		return 0, fmt.Errorf("unsupported weight units %q", units)
+	}
+
+	fromKg, err := toKg(from)
+	if err != nil {
+		return 0, err
+	}
+	toKgs, err := toKg(to)
+	if err != nil {
+		return 0, err
+	}
+	return value * fromKg / toKgs, nil
+}
+
+// TrendPoint is a measurement alongside its smoothed value.
+type TrendPoint struct {
+	Measurement
+	// Average of the readings over the trailing window, ending on this one.
+	Average float64
+}
+
+// MovingAverage smooths the measurements with a trailing average over the
+// given number of days, so a single salty dinner doesn't look like a trend.
+// The measurements should all be the same kind; they're returned sorted by date.
+func MovingAverage(ms []Measurement, days int) []TrendPoint {
+	sorted := append([]Measurement(nil), ms...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	points := make([]TrendPoint, len(sorted))
+	start, total := 0, 0.0
+	for i, m := range sorted {
+		total += m.Value
+		for !m.Date.Before(sorted[start].Date.AddDays(days)) {
+			total -= sorted[start].Value
+			start++
+		}
+		points[i] = TrendPoint{Measurement: m, Average: total / float64(i-start+1)}
+	}
+	return points
+}
+
+// Bodyweights is a history of bodyweight measurements in date order.
+type Bodyweights []Measurement
+
+// NewBodyweights picks the bodyweight readings out of the measurements.
+func NewBodyweights(ms []Measurement) Bodyweights {
+	b := make(Bodyweights, 0)
+	for _, m := range ms {
+		if m.Kind == Bodyweight {
+			b = append(b, m)
+		}
+	}
+	sort.SliceStable(b, func(i, j int) bool {
+		return b[i].Date.Before(b[j].Date)
+	})
+	return b
+}
+
+// On finds what you weighed on a date: the latest reading on or before it, or
+// the earliest reading if you started weighing yourself later.
+func (b Bodyweights) On(date civil.Date) (Measurement, bool) {
+	if len(b) == 0 {
+		return Measurement{}, false
+	}
+	i := sort.Search(len(b), func(i int) bool {
+		return b[i].Date.After(date)
+	})
+	if i == 0 {
+		return b[0], true
+	}
+	return b[i-1], true
+}
+
+// IsBodyweightExercise is true if the repetition's load is your own body, e.g.
+// pull-ups logged in "bodyweight" units with any added weight as Weight.
+func (r Repetition) IsBodyweightExercise() bool {
+	switch strings.ToLower(r.Units) {
+	case "bodyweight", "bw":
+		return true
+	}
+	return false
+}
+
+// EffectiveLoad is the weight actually moved, in the given units: the
+// repetition's weight, plus your bodyweight for bodyweight exercises.
+func (r Repetition) EffectiveLoad(bodyweight Measurement, units string) (float64, error) {
+	if !r.IsBodyweightExercise() {
+		return massIn(float64(r.Weight), r.Units, units)
+	}
+
+	// added weight on a bodyweight exercise is assumed to be in the same
+	// units as the bodyweight.
+	return massIn(bodyweight.Value+float64(r.Weight), bodyweight.Units, units)
+}
+
+// RelativeStrength is the heaviest successful lift of an exercise, compared to
+// what you weighed at the time.
+type RelativeStrength struct {
+	Exercise   string
+	Repetition Repetition
+	// Load and Bodyweight are in kg.
+	Load       float64
+	Bodyweight float64
+	// Ratio of the load to your bodyweight.
+	Ratio float64
+	// Wilks and DOTS scores for the single lift, zero if your sex is unknown.
+	Wilks float64
+	DOTS  float64
+}
+
+// AnalyzeStrength finds the heaviest successful lift of each exercise and how
+// strong that was relative to your bodyweight on the day. Exercises that
+// aren't measured in weight are skipped, as is everything if there are no
+// bodyweights.
+func AnalyzeStrength(reps []Repetition, bodyweights Bodyweights, sex Sex) []RelativeStrength {
+	best := make(map[string]RelativeStrength)
+
+	for _, r := range reps {
+		if r.Failure {
+			continue
+		}
+		bw, ok := bodyweights.On(r.SessionDate)
+		if !ok {
+			continue
+		}
+		load, err := r.EffectiveLoad(bw, "kg")
+		if err != nil || load <= 0 {
+			continue
+		}
+		bwKg, err := massIn(bw.Value, bw.Units, "kg")
+		if err != nil || bwKg <= 0 {
+			continue
+		}
+
+		if previous, ok := best[r.Exercise]; ok && previous.Load >= load {
+			continue
+		}
+
+		strength := RelativeStrength{
+			Exercise:   r.Exercise,
+			Repetition: r,
+			Load:       load,
+			Bodyweight: bwKg,
+			Ratio:      load / bwKg,
+		}
+		if sex != "" {
+			strength.Wilks = Wilks(sex, bwKg, load)
+			strength.DOTS = DOTS(sex, bwKg, load)
+		}
+		best[r.Exercise] = strength
+	}
+
+	strengths := make([]RelativeStrength, 0, len(best))
+	for _, s := range best {
+		strengths = append(strengths, s)
+	}
+	sort.Slice(strengths, func(i, j int) bool {
+		return strengths[i].Exercise < strengths[j].Exercise
+	})
+	return strengths
+}
@@ -0,0 +1,88 @@
+package lifting
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"cloud.google.com/go/civil"
+)
+
+func TestMovingAverage(t *testing.T) {
+	ms := []Measurement{
+		Measurement{Kind: Bodyweight, Value: 184, Date: civil.Date{Year: 2018, Month: 12, Day: 10}},
+		Measurement{Kind: Bodyweight, Value: 180, Date: civil.Date{Year: 2018, Month: 12, Day: 1}},
+		Measurement{Kind: Bodyweight, Value: 182, Date: civil.Date{Year: 2018, Month: 12, Day: 3}},
+	}
+
+	trend := MovingAverage(ms, 7)
+
+	expected := []float64{180, 181, 184}
+	for i, p := range trend {
+		if p.Average != expected[i] {
+			t.Fatal("mimsatch", fmt.Sprintf("expected %#v", expected), fmt.Sprintf("found %#v", trend))
+		}
+	}
+}
+
+func TestRelativeStrength(t *testing.T) {
+	bodyweights := NewBodyweights([]Measurement{
+		Measurement{Kind: Bodyweight, Value: 100, Units: "kg", Date: civil.Date{Year: 2018, Month: 12, Day: 1}},
+		Measurement{Kind: Sleep, Value: 8, Units: "hours", Date: civil.Date{Year: 2018, Month: 12, Day: 2}},
+		Measurement{Kind: Bodyweight, Value: 90, Units: "kg", Date: civil.Date{Year: 2018, Month: 12, Day: 20}},
+	})
+
+	if len(bodyweights) != 2 {
+		t.Fatal("expected only the bodyweights", bodyweights)
+	}
+
+	if bw, _ := bodyweights.On(civil.Date{Year: 2018, Month: 12, Day: 19}); bw.Value != 100 {
+		t.Fatal("expected the latest reading before the date", bw)
+	}
+
+	reps := []Repetition{
+		Repetition{
+			Exercise:    "squat",
+			Weight:      200,
+			Units:       "kg",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 5},
+		},
+		Repetition{
+			Exercise:    "squat",
+			Weight:      220,
+			Units:       "kg",
+			Failure:     true,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 6},
+		},
+		Repetition{
+			Exercise:    "pull up",
+			Weight:      10,
+			Units:       "bodyweight",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 21},
+		},
+		Repetition{
+			Exercise:    "run",
+			Volume:      3,
+			Units:       "miles",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 21},
+		},
+	}
+
+	strength := AnalyzeStrength(reps, bodyweights, Male)
+	if len(strength) != 2 {
+		t.Fatal("expected pull ups and squats", strength)
+	}
+
+	pullUp, squat := strength[0], strength[1]
+	if pullUp.Load != 100 || pullUp.Ratio < 1.11 || pullUp.Ratio > 1.12 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", pullUp))
+	}
+
+	if squat.Load != 200 || squat.Ratio != 2 {
+		t.Fatal("failed lifts shouldn't count", fmt.Sprintf("found %#v", squat))
+	}
+
+	if math.Abs(squat.Wilks-121.7) > 0.1 || math.Abs(squat.DOTS-123.1) > 0.1 {
+		t.Fatal("unexpected scores", squat.Wilks, squat.DOTS)
+	}
+}
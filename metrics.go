@@ -0,0 +1,331 @@
+package lifting
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+// buckets are the upper bounds in seconds of the latency histograms.
+var buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram counts observations into buckets, Prometheus style, each bucket
+// counting everything up to its bound.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	for i, bound := range buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+type requestKey struct {
+	route, method string
+}
+
+type statusKey struct {
+	route, method string
+	status        int
+}
+
+// Metrics counts requests and storage calls and how long they take, to serve
+// in the Prometheus text format.
+type Metrics struct {
+	mu            sync.Mutex
+	requests      map[statusKey]uint64
+	latency       map[requestKey]*histogram
+	storage       map[string]*histogram
+	storageErrors map[string]uint64
+}
+
+// NewMetrics makes an empty set of metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:      make(map[statusKey]uint64),
+		latency:       make(map[requestKey]*histogram),
+		storage:       make(map[string]*histogram),
+		storageErrors: make(map[string]uint64),
+	}
+}
+
+// ObserveRequest counts a request to a route, e.g. "/edit/{id}", and how long
+// it took.
+func (m *Metrics) ObserveRequest(route, method string, status int, took time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[statusKey{route, method, status}]++
+	key := requestKey{route, method}
+	if m.latency[key] == nil {
+		m.latency[key] = &histogram{}
+	}
+	m.latency[key].observe(took.Seconds())
+}
+
+// ObserveStorage counts a call to a storage method, and how long it took.
+func (m *Metrics) ObserveStorage(method string, took time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.storage[method] == nil {
+		m.storage[method] = &histogram{}
+	}
+	m.storage[method].observe(took.Seconds())
+	if err != nil {
+		m.storageErrors[method]++
+	}
+}
+
+// labels formats label pairs, which must come as name, value, name, value...
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+"="+strconv.Quote(pairs[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func writeHistogram(w io.Writer, name string, h *histogram, pairs ...string) {
+	for i, bound := range buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels(append(pairs, "le", formatFloat(bound))...), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels(append(pairs, "le", "+Inf")...), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels(pairs...), formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels(pairs...), h.count)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format, sorted so
+// they come out the same way each time.
+func (m *Metrics) WritePrometheus(out io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w := bufio.NewWriter(out)
+
+	statuses := make([]statusKey, 0, len(m.requests))
+	for key := range m.requests {
+		statuses = append(statuses, key)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	fmt.Fprintln(w, "# HELP lifting_http_requests_total Requests handled, by route, method and status.")
+	fmt.Fprintln(w, "# TYPE lifting_http_requests_total counter")
+	for _, key := range statuses {
+		fmt.Fprintf(w, "lifting_http_requests_total%s %d\n",
+			labels("route", key.route, "method", key.method, "status", strconv.Itoa(key.status)), m.requests[key])
+	}
+
+	routes := make([]requestKey, 0, len(m.latency))
+	for key := range m.latency {
+		routes = append(routes, key)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].route != routes[j].route {
+			return routes[i].route < routes[j].route
+		}
+		return routes[i].method < routes[j].method
+	})
+	fmt.Fprintln(w, "# HELP lifting_http_request_duration_seconds How long requests took, by route and method.")
+	fmt.Fprintln(w, "# TYPE lifting_http_request_duration_seconds histogram")
+	for _, key := range routes {
+		writeHistogram(w, "lifting_http_request_duration_seconds", m.latency[key], "route", key.route, "method", key.method)
+	}
+
+	methods := make([]string, 0, len(m.storage))
+	for method := range m.storage {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	fmt.Fprintln(w, "# HELP lifting_storage_duration_seconds How long storage calls took, by method.")
+	fmt.Fprintln(w, "# TYPE lifting_storage_duration_seconds histogram")
+	for _, method := range methods {
+		writeHistogram(w, "lifting_storage_duration_seconds", m.storage[method], "method", method)
+	}
+	fmt.Fprintln(w, "# HELP lifting_storage_errors_total Storage calls that failed, by method.")
+	fmt.Fprintln(w, "# TYPE lifting_storage_errors_total counter")
+	for _, method := range methods {
+		fmt.Fprintf(w, "lifting_storage_errors_total%s %d\n", labels("method", method), m.storageErrors[method])
+	}
+	return w.Flush()
+}
+
+// WriteGauge writes a gauge in the Prometheus text format.
+func WriteGauge(w io.Writer, name, help string, value float64) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatFloat(value))
+	return err
+}
+
+// Instrument times every call to the storage in the metrics.
+func (m *Metrics) Instrument(s ContextStorage) ContextStorage {
+	return instrumented{s, m}
+}
+
+type instrumented struct {
+	s ContextStorage
+	m *Metrics
+}
+
+func (i instrumented) observe(method string, start time.Time, err error) {
+	i.m.ObserveStorage(method, time.Since(start), err)
+}
+
+func (i instrumented) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { i.observe("Ping", start, err) }(time.Now())
+	return i.s.Ping(ctx)
+}
+
+func (i instrumented) Delete(ctx context.Context, id int) (err error) {
+	defer func(start time.Time) { i.observe("Delete", start, err) }(time.Now())
+	return i.s.Delete(ctx, id)
+}
+
+func (i instrumented) Restore(ctx context.Context, id int) (err error) {
+	defer func(start time.Time) { i.observe("Restore", start, err) }(time.Now())
+	return i.s.Restore(ctx, id)
+}
+
+func (i instrumented) GetTrash(ctx context.Context) (trashed []Trashed, err error) {
+	defer func(start time.Time) { i.observe("GetTrash", start, err) }(time.Now())
+	return i.s.GetTrash(ctx)
+}
+
+func (i instrumented) CountTrash(ctx context.Context) (count int, err error) {
+	defer func(start time.Time) { i.observe("CountTrash", start, err) }(time.Now())
+	return i.s.CountTrash(ctx)
+}
+
+func (i instrumented) Purge(ctx context.Context, before time.Time) (purged int, err error) {
+	defer func(start time.Time) { i.observe("Purge", start, err) }(time.Now())
+	return i.s.Purge(ctx, before)
+}
+
+func (i instrumented) GetChanges(ctx context.Context, id int) (changes []Change, err error) {
+	defer func(start time.Time) { i.observe("GetChanges", start, err) }(time.Now())
+	return i.s.GetChanges(ctx, id)
+}
+
+func (i instrumented) ChangesSince(ctx context.Context, seq int) (changes []Change, err error) {
+	defer func(start time.Time) { i.observe("ChangesSince", start, err) }(time.Now())
+	return i.s.ChangesSince(ctx, seq)
+}
+
+func (i instrumented) Load(ctx context.Context, repetitions []Repetition) (err error) {
+	defer func(start time.Time) { i.observe("Load", start, err) }(time.Now())
+	return i.s.Load(ctx, repetitions)
+}
+
+func (i instrumented) GetLast(ctx context.Context, count int, cursor string) (result Result, err error) {
+	defer func(start time.Time) { i.observe("GetLast", start, err) }(time.Now())
+	return i.s.GetLast(ctx, count, cursor)
+}
+
+func (i instrumented) GetByID(ctx context.Context, id int) (repetition *Repetition, err error) {
+	defer func(start time.Time) { i.observe("GetByID", start, err) }(time.Now())
+	return i.s.GetByID(ctx, id)
+}
+
+func (i instrumented) GetByClientID(ctx context.Context, clientID string) (repetition *Repetition, err error) {
+	defer func(start time.Time) { i.observe("GetByClientID", start, err) }(time.Now())
+	return i.s.GetByClientID(ctx, clientID)
+}
+
+func (i instrumented) GetBetween(ctx context.Context, start, end civil.Date) (reps []Repetition, err error) {
+	defer func(begin time.Time) { i.observe("GetBetween", begin, err) }(time.Now())
+	return i.s.GetBetween(ctx, start, end)
+}
+
+func (i instrumented) CountBetween(ctx context.Context, start, end civil.Date) (count int, err error) {
+	defer func(begin time.Time) { i.observe("CountBetween", begin, err) }(time.Now())
+	return i.s.CountBetween(ctx, start, end)
+}
+
+func (i instrumented) GetUniqueCategories(ctx context.Context) (categories []string, err error) {
+	defer func(start time.Time) { i.observe("GetUniqueCategories", start, err) }(time.Now())
+	return i.s.GetUniqueCategories(ctx)
+}
+
+func (i instrumented) GetByCategory(ctx context.Context, label string, count, offset int) (reps []Repetition, err error) {
+	defer func(start time.Time) { i.observe("GetByCategory", start, err) }(time.Now())
+	return i.s.GetByCategory(ctx, label, count, offset)
+}
+
+func (i instrumented) GetUniqueExercises(ctx context.Context) (exercises []string, err error) {
+	defer func(start time.Time) { i.observe("GetUniqueExercises", start, err) }(time.Now())
+	return i.s.GetUniqueExercises(ctx)
+}
+
+func (i instrumented) GetUniqueUnits(ctx context.Context) (units []string, err error) {
+	defer func(start time.Time) { i.observe("GetUniqueUnits", start, err) }(time.Now())
+	return i.s.GetUniqueUnits(ctx)
+}
+
+func (i instrumented) Search(ctx context.Context, q Query) (result Result, err error) {
+	defer func(start time.Time) { i.observe("Search", start, err) }(time.Now())
+	return i.s.Search(ctx, q)
+}
+
+func (i instrumented) AttachTrack(ctx context.Context, track Track) (err error) {
+	defer func(start time.Time) { i.observe("AttachTrack", start, err) }(time.Now())
+	return i.s.AttachTrack(ctx, track)
+}
+
+func (i instrumented) LoadWithTrack(ctx context.Context, repetition *Repetition, track Track) (err error) {
+	defer func(start time.Time) { i.observe("LoadWithTrack", start, err) }(time.Now())
+	return i.s.LoadWithTrack(ctx, repetition, track)
+}
+
+func (i instrumented) GetTrack(ctx context.Context, id int) (track *Track, err error) {
+	defer func(start time.Time) { i.observe("GetTrack", start, err) }(time.Now())
+	return i.s.GetTrack(ctx, id)
+}
+
+func (i instrumented) LoadMeasurements(ctx context.Context, measurements []Measurement) (err error) {
+	defer func(start time.Time) { i.observe("LoadMeasurements", start, err) }(time.Now())
+	return i.s.LoadMeasurements(ctx, measurements)
+}
+
+func (i instrumented) GetMeasurements(ctx context.Context, kind string, start, end civil.Date) (measurements []Measurement, err error) {
+	defer func(begin time.Time) { i.observe("GetMeasurements", begin, err) }(time.Now())
+	return i.s.GetMeasurements(ctx, kind, start, end)
+}
+
+func (i instrumented) DeleteMeasurement(ctx context.Context, id int) (err error) {
+	defer func(start time.Time) { i.observe("DeleteMeasurement", start, err) }(time.Now())
+	return i.s.DeleteMeasurement(ctx, id)
+}
+
+func (i instrumented) LoadBackup(ctx context.Context, backup Backup) (err error) {
+	defer func(start time.Time) { i.observe("LoadBackup", start, err) }(time.Now())
+	return i.s.LoadBackup(ctx, backup)
+}
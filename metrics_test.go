@@ -0,0 +1,77 @@
+package lifting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+// countingStorage only counts, so serving the metrics panics if it reads the
+// repetitions instead.
+type countingStorage struct {
+	ContextStorage
+	today, trash int
+}
+
+func (s countingStorage) CountBetween(ctx context.Context, start, end civil.Date) (int, error) {
+	return s.today, nil
+}
+
+func (s countingStorage) CountTrash(ctx context.Context) (int, error) {
+	return s.trash, nil
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveRequest("/edit/{id}", "GET", 200, 20*time.Millisecond)
+	m.ObserveRequest("/edit/{id}", "GET", 200, 2*time.Second)
+	m.ObserveRequest("", "GET", 404, time.Millisecond)
+	m.ObserveStorage("GetByID", 3*time.Millisecond, nil)
+	m.ObserveStorage("GetByID", 3*time.Millisecond, errors.New("gone"))
+
+	var out bytes.Buffer
+	if err := m.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteGauge(&out, "lifting_repetitions_today", "Repetitions logged for today.", 4); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`# TYPE lifting_http_requests_total counter`,
+		`lifting_http_requests_total{route="/edit/{id}",method="GET",status="200"} 2`,
+		`lifting_http_requests_total{route="unmatched",method="GET",status="404"} 1`,
+		`lifting_http_request_duration_seconds_bucket{route="/edit/{id}",method="GET",le="0.025"} 1`,
+		`lifting_http_request_duration_seconds_bucket{route="/edit/{id}",method="GET",le="2.5"} 2`,
+		`lifting_http_request_duration_seconds_bucket{route="/edit/{id}",method="GET",le="+Inf"} 2`,
+		`lifting_http_request_duration_seconds_count{route="/edit/{id}",method="GET"} 2`,
+		`lifting_storage_duration_seconds_bucket{method="GetByID",le="0.005"} 2`,
+		`lifting_storage_errors_total{method="GetByID"} 1`,
+		`# TYPE lifting_repetitions_today gauge`,
+		`lifting_repetitions_today 4`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Fatal("expected", line, "in", out.String())
+		}
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	h := &Handlers{Storage: countingStorage{today: 3, trash: 2}, Metrics: NewMetrics()}
+	w := httptest.NewRecorder()
+	h.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, line := range []string{
+		`lifting_repetitions_today 3`,
+		`lifting_trash_repetitions 2`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Fatal("expected", line, "in", w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lifting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	var logs bytes.Buffer
+	h := &Handlers{
+		Logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+		Middleware: []Middleware{func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			})
+		}},
+	}
+
+	w := httptest.NewRecorder()
+	h.Handle(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", http.StatusInternalServerError), fmt.Sprintf("found %#v", w.Code))
+	}
+	id := w.Header().Get(requestIDHeader)
+	if id == "" || !strings.Contains(w.Body.String(), id) {
+		t.Fatal("expected the error page to give the request id", id, w.Body.String())
+	}
+
+	var panicked, logged bool
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err, line)
+		}
+		if entry["request_id"] != id {
+			t.Fatal("mimsatch", fmt.Sprintf("expected %#v", id), fmt.Sprintf("found %#v", entry["request_id"]))
+		}
+		switch entry["msg"] {
+		case "panic":
+			panicked = entry["panic"] == "boom" && entry["stack"] != ""
+		case "request":
+			logged = entry["status"] == float64(http.StatusInternalServerError) && entry["path"] == "/"
+		}
+	}
+	if !panicked || !logged {
+		t.Fatal("expected the panic and the request to be logged", logs.String())
+	}
+}
+
+func TestWriteJSONLogs(t *testing.T) {
+	var logs bytes.Buffer
+	h := &Handlers{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+	r := httptest.NewRequest("GET", "/api/strength", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, "abc"))
+
+	// a channel can't be encoded.
+	h.writeJSON(httptest.NewRecorder(), r, make(chan int))
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatal(err, logs.String())
+	}
+	if entry["msg"] != "encoding json" || entry["request_id"] != "abc" || entry["path"] != "/api/strength" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", "the failure logged with the request id"), fmt.Sprintf("found %#v", entry))
+	}
+}
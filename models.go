@@ -1,7 +1,6 @@
 package lifting
 
 import (
-	"fmt"
 	"cloud.google.com/go/civil"
 	"database/sql"
 	"time"
@@ -37,6 +36,16 @@ type (
 		Sets int
 		// anything about the specific workout not captured in other parameters
 		Comment string
+		// Rest is how long was rested before it, if the rest was timed.
+		Rest time.Duration `json:",omitempty"`
+		// When it was first stored and last changed, set by the backends and
+		// zero for anything stored before they were tracked.
+		CreatedAt, UpdatedAt time.Time
+		// Seq is the sequence number of the last change to it, see ChangesSince.
+		Seq int
+		// ClientID is an ID the client made up for it, so sending it again
+		// doesn't store it twice, see GetByClientID. Empty for most.
+		ClientID string `json:",omitempty"`
 	}
 
 	// WorkoutRow represents The SQL database format for the Repetition
@@ -53,6 +62,12 @@ type (
 		Failure     bool
 		Comment     sql.NullString
 		Sets        sql.NullInt64
+		CreatedAt   sql.NullTime `db:"created_at"`
+		UpdatedAt   sql.NullTime `db:"updated_at"`
+		Seq         sql.NullInt64
+		ClientID    sql.NullString `db:"client_id"`
+		// Rest is in seconds.
+		Rest sql.NullInt64
 	}
 
 	// CategoryQuery represents how we pull by category out of the database
@@ -72,7 +87,9 @@ func ParseSessionDateString(date string) (civil.Date, error) {
 	return civil.ParseDate(date)
 }
 
-// RepetitionToWorkout transforms from a repetition to a workout row.
+// RepetitionToWorkout transforms from a repetition to a workout row, an
+// *InvalidRepetitionError if it isn't valid, so no backend stores one that
+// isn't.
 func RepetitionToWorkout(r Repetition) (WorkoutRow, error) {
 	effort := sql.NullInt64{Valid: false}
 	volume := sql.NullFloat64{Valid: false}
@@ -82,8 +99,8 @@ func RepetitionToWorkout(r Repetition) (WorkoutRow, error) {
 	elapsed := sql.NullString{Valid: false}
 	comment := sql.NullString{Valid: false}
 	units := sql.NullString{Valid: false}
-
-	var nullSessionDate civil.Date
+	clientID := sql.NullString{Valid: false}
+	rest := sql.NullInt64{Valid: false}
 
 	if r.Effort != 0 {
 		effort = sql.NullInt64{Int64: int64(r.Effort), Valid: true}
@@ -113,10 +130,17 @@ func RepetitionToWorkout(r Repetition) (WorkoutRow, error) {
 		units = sql.NullString{String: r.Units, Valid: true}
 	}
 
-	if r.SessionDate == nullSessionDate {
-		return WorkoutRow{}, fmt.Errorf("session date must be set on repetition %v", r)
+	if r.ClientID != "" {
+		clientID = sql.NullString{String: r.ClientID, Valid: true}
+	}
+
+	if r.Rest != 0 {
+		rest = sql.NullInt64{Int64: int64(r.Rest / time.Second), Valid: true}
 	}
 
+	if err := r.Validate(); err != nil {
+		return WorkoutRow{}, err
+	}
 
 	return WorkoutRow{
 		ID:          r.ID,
@@ -131,6 +155,8 @@ func RepetitionToWorkout(r Repetition) (WorkoutRow, error) {
 		Category:    Category,
 		Sets:        sets,
 		Comment:     comment,
+		ClientID:    clientID,
+		Rest:        rest,
 	}, nil
 }
 
@@ -203,6 +229,11 @@ func WorkoutToRepetition(w WorkoutRow) (Repetition, error) {
 		Category:    Category,
 		Sets:        sets,
 		Comment:     comment,
+		CreatedAt:   w.CreatedAt.Time,
+		UpdatedAt:   w.UpdatedAt.Time,
+		Seq:         int(w.Seq.Int64),
+		ClientID:    w.ClientID.String,
+		Rest:        time.Duration(w.Rest.Int64) * time.Second,
 	}
 	return rep, nil
 }
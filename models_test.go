@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestConversion(t *testing.T) {
@@ -17,6 +18,7 @@ func TestConversion(t *testing.T) {
 		Units:       "lbs",
 		Failure:     false,
 		Category:    "strength",
+		Rest:        90 * time.Second,
 	}
 
 	expected := WorkoutRow{
@@ -28,6 +30,7 @@ func TestConversion(t *testing.T) {
 		Units:       sql.NullString{String: "lbs", Valid: true},
 		Failure:     false,
 		Category:    sql.NullString{String: "strength", Valid: true},
+		Rest:        sql.NullInt64{Int64: 90, Valid: true},
 	}
 
 	workout, err := RepetitionToWorkout(r)
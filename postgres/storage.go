@@ -1,12 +1,16 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"cloud.google.com/go/civil"
 	"github.com/awinterman/lifting"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // its driver
+	"github.com/lib/pq"
 )
 
 const (
@@ -27,18 +31,95 @@ const (
             );
         `
 
+	trackSchema = `
+            CREATE TABLE IF NOT EXISTS track (
+               workout_id integer primary key,
+               format varchar NOT NULL,
+               data bytea NOT NULL
+            );
+        `
+
+	measurementSchema = `
+            CREATE TABLE IF NOT EXISTS measurement (
+               id serial primary key,
+               kind varchar NOT NULL,
+               site varchar,
+               value double precision NOT NULL,
+               units varchar,
+               measured_on date NOT NULL,
+               comment text
+            );
+        `
+
+	// changeSchema logs every change to a workout, with JSON snapshots of it
+	// before and after.
+	changeSchema = `
+            CREATE TABLE IF NOT EXISTS workout_change (
+               id serial primary key,
+               workout_id integer NOT NULL,
+               action varchar NOT NULL,
+               actor varchar,
+               changed_at timestamptz NOT NULL,
+               before_version jsonb,
+               after_version jsonb
+            );
+        `
+
+	// migrations add the columns older databases are missing, and stamp the
+	// rows that were stored before them from the change log, or their session
+	// date if they were never changed.
+	migrations = `
+            ALTER TABLE workout ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+            ALTER TABLE workout ADD COLUMN IF NOT EXISTS created_at timestamptz;
+            ALTER TABLE workout ADD COLUMN IF NOT EXISTS updated_at timestamptz;
+            ALTER TABLE workout ADD COLUMN IF NOT EXISTS seq integer;
+            ALTER TABLE workout ADD COLUMN IF NOT EXISTS client_id varchar;
+            ALTER TABLE workout ADD COLUMN IF NOT EXISTS rest integer;
+            CREATE UNIQUE INDEX IF NOT EXISTS workout_client_id ON workout(client_id);
+            UPDATE workout SET
+               created_at = COALESCE(created_at, (SELECT min(changed_at) FROM workout_change c WHERE c.workout_id = workout.id), session_date),
+               updated_at = COALESCE(updated_at, (SELECT max(changed_at) FROM workout_change c WHERE c.workout_id = workout.id), created_at, session_date),
+               seq = COALESCE(seq, (SELECT max(id) FROM workout_change c WHERE c.workout_id = workout.id), 0)
+            WHERE created_at IS NULL OR updated_at IS NULL OR seq IS NULL;
+        `
+
+	// ftsIndex speeds up searching comments.
+	ftsIndex = `
+            CREATE INDEX IF NOT EXISTS workout_comment_fts
+            ON workout USING gin (to_tsvector('english', coalesce(comment, '')));
+        `
+
 	drop = `
+            DROP TABLE IF EXISTS workout_change;
+            DROP TABLE IF EXISTS measurement;
+            DROP TABLE IF EXISTS track;
             DROP TABLE IF EXISTS workout;
         `
 	namedInsert = `INSERT INTO workout(
             exercise, effort, volume, weight, duration, session_date, units, 
-			failure, category, comment, sets
+			failure, category, comment, sets, client_id, rest
         ) values (
             :exercise, :effort, :volume, :weight, :duration, :session_date, 
-			:units, :failure, :category, :comment, :sets
-		)`
-	//
-	namedDelete = `DELETE FROM workout WHERE id = :id`
+			:units, :failure, :category, :comment, :sets, :client_id, :rest
+		) RETURNING id`
+	// deleting moves a row to the trash by stamping deleted_at, purging
+	// removes it for good.
+	trash    = `UPDATE workout SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL`
+	restore  = `UPDATE workout SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+	getTrash = `
+            SELECT
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, sets, created_at, updated_at, seq, client_id, rest, deleted_at
+            FROM workout WHERE deleted_at IS NOT NULL
+            ORDER BY deleted_at DESC, id DESC`
+	countTrash = `SELECT COUNT(*) FROM workout WHERE deleted_at IS NOT NULL`
+	// restoreStamps puts back when a restored workout was created, updated
+	// and deleted.
+	restoreStamps = `UPDATE workout
+			SET created_at = COALESCE($1, created_at), updated_at = COALESCE($2, updated_at), deleted_at = $3
+			WHERE id = $4`
+	purgeTracks = `DELETE FROM track WHERE workout_id IN (SELECT id FROM workout WHERE deleted_at <= $1)`
+	purge       = `DELETE FROM workout WHERE deleted_at <= $1`
+
 	namedUpdate = `UPDATE workout
 			SET exercise = :exercise,
 				 effort = :effort,
@@ -50,30 +131,89 @@ const (
 				 failure = :failure, 
 				 category = :category,
 				 comment = :comment,
-				 sets = :sets
+				 sets = :sets,
+				 rest = :rest
 			WHERE
-				id = :id
+				id = :id AND deleted_at IS NULL
 
             `
 
-	uniquecategory = `SELECT DISTINCT category FROM workout`
-	uniqueExercise = `SELECT DISTINCT exercise FROM workout`
-	uniqueUnits    = `SELECT DISTINCT units FROM workout WHERE units is not null and units != ''`
+	namedInsertChange = `INSERT INTO workout_change(
+            workout_id, action, actor, changed_at, before_version, after_version
+        ) values (
+            :workout_id, :action, :actor, :changed_at, :before_version, :after_version
+        ) RETURNING id`
+	// lockChanges serializes the transactions writing to the change log, so
+	// they commit in the order of their change IDs. Otherwise one could
+	// commit a lower ID after ChangesSince had already returned a higher one,
+	// and a consumer carrying on from the higher one would never see it. The
+	// key is arbitrary, it only has to be the same everywhere.
+	lockChanges = `SELECT pg_advisory_xact_lock(4096)`
+	// stamp marks a workout with its latest change.
+	stamp = `UPDATE workout
+			SET seq = $1, updated_at = $2, created_at = COALESCE(created_at, $2)
+			WHERE id = $3`
+	changesSince = `
+            SELECT id, workout_id, action, actor, changed_at, before_version, after_version
+            FROM workout_change WHERE id > $1
+            ORDER BY id LIMIT $2`
+	getChanges = `
+            SELECT id, workout_id, action, actor, changed_at, before_version, after_version
+            FROM workout_change WHERE workout_id = $1
+            ORDER BY id`
+
+	namedInsertTrack = `INSERT INTO track(workout_id, format, data)
+			values (:workout_id, :format, :data)
+			ON CONFLICT (workout_id) DO UPDATE SET format = excluded.format, data = excluded.data`
+	getTrack = `SELECT workout_id, format, data FROM track WHERE workout_id = :id`
+
+	namedInsertMeasurement = `INSERT INTO measurement(
+            kind, site, value, units, measured_on, comment
+        ) values (
+            :kind, :site, :value, :units, :measured_on, :comment
+        ) RETURNING id`
+	namedUpdateMeasurement = `UPDATE measurement
+			SET kind = :kind,
+				site = :site,
+				value = :value,
+				units = :units,
+				measured_on = :measured_on,
+				comment = :comment
+			WHERE
+				id = :id`
+	namedDeleteMeasurement = `DELETE FROM measurement WHERE id = :id`
+	getMeasurements        = `
+            SELECT id, kind, site, value, units, measured_on, comment
+            FROM measurement
+            WHERE (:kind = '' OR kind = :kind) AND measured_on BETWEEN :start AND :end
+            ORDER BY measured_on, id`
+
+	uniquecategory = `SELECT DISTINCT category FROM workout WHERE deleted_at IS NULL`
+	uniqueExercise = `SELECT DISTINCT exercise FROM workout WHERE deleted_at IS NULL`
+	uniqueUnits    = `SELECT DISTINCT units FROM workout WHERE units is not null and units != '' AND deleted_at IS NULL`
 
-	getlast = `
-            SELECT 
-            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, sets
-            FROM workout 
-            ORDER BY session_date desc, id desc LIMIT :count OFFSET :offset`
 	getBetween = `
             SELECT 
-            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, sets
-            FROM workout WHERE session_date BETWEEN :start and :end
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, sets, created_at, updated_at, seq, client_id, rest
+            FROM workout WHERE session_date BETWEEN :start and :end AND deleted_at IS NULL
             ORDER BY session_date DESC, id DESC`
+	countBetween = `SELECT COUNT(*) FROM workout WHERE session_date BETWEEN $1 and $2 AND deleted_at IS NULL`
+
+	search = `
+            SELECT
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, sets, created_at, updated_at, seq, client_id, rest
+            FROM workout %s %s LIMIT :count`
+	exists     = `SELECT EXISTS (SELECT 1 FROM workout %s)`
+	textSearch = `to_tsvector('english', coalesce(comment, '')) @@ plainto_tsquery('english', :text)`
+
 	getByID = `
             SELECT 
-            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, sets
-            FROM workout WHERE id = :id`
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, sets, created_at, updated_at, seq, client_id, rest
+            FROM workout WHERE id = :id AND deleted_at IS NULL`
+	getByClientID = `
+            SELECT
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, sets, created_at, updated_at, seq, client_id, rest
+            FROM workout WHERE client_id = :client_id`
 	getByCategory = `
 			WITH vars AS (SELECT :category as category)
             SELECT 
@@ -89,6 +229,7 @@ const (
 				false as failure,
 				workout.category as category
 			FROM workout INNER JOIN vars ON(workout.category LIKE '%'||vars.category||'%')
+			WHERE workout.deleted_at IS NULL
 			GROUP BY exercise, vars.category, workout.category, units
 			ORDER BY 
 				workout.category = vars.category, workout.category like vars.category||'%', workout.category like '%'||vars.category||'%',
@@ -99,15 +240,15 @@ const (
 )
 
 type between struct {
-	Start, End civil.Date
+	Start, End string
 }
 
 type byID struct {
 	ID int
 }
 
-type pagination struct {
-	Count, Offset int
+type byClientID struct {
+	ClientID string `db:"client_id"`
 }
 
 // LiftingStorage is a sqlite implementation of the Storage interface
@@ -130,9 +271,10 @@ func CreateStorage(connection string, db *sqlx.DB) (*LiftingStorage, error) {
 		if err != nil {
 			return nil, err
 		}
-		s.db.MustExec(workoutSchema)
-		if err != nil {
-			return nil, err
+		for _, schema := range []string{workoutSchema, trackSchema, measurementSchema, changeSchema, migrations, ftsIndex} {
+			if _, err = s.db.Exec(schema); err != nil {
+				return nil, err
+			}
 		}
 		return &s, nil
 	}
@@ -145,74 +287,297 @@ func (s *LiftingStorage) Drop() error {
 	return err
 }
 
+// Ping checks the database can be reached.
+func (s *LiftingStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 //Load the repetitions into the database
-func (s *LiftingStorage) Load(repetitions []lifting.Repetition) error {
-	tx, err := s.db.Beginx()
+func (s *LiftingStorage) Load(ctx context.Context, repetitions []lifting.Repetition) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	for _, rep := range repetitions {
+	for i, rep := range repetitions {
 		workout, err := lifting.RepetitionToWorkout(rep)
 		if err != nil {
 			tx.Rollback()
-			return err
+			return lifting.InvalidAt(err, i)
 		}
 
 		if workout.ID == nil {
-			fmt.Println(workout.Sets)
-			_, err = tx.NamedExec(
-				namedInsert,
-				&workout,
-			)
+			repetitions[i].ID, err = insertReturningID(ctx, tx, namedInsert, &workout)
+			if err == nil {
+				err = recordChange(ctx, tx, *repetitions[i].ID, lifting.Inserted, nil, &repetitions[i])
+			}
 		} else {
-			fmt.Println(workout.Sets)
-			_, err = tx.NamedExec(
-				namedUpdate,
-				&workout,
-			)
-
+			var before *lifting.Repetition
+			before, err = getInTx(ctx, tx, *workout.ID)
+			if err == nil {
+				_, err = tx.NamedExecContext(
+					ctx,
+					namedUpdate,
+					&workout,
+				)
+			}
+			if err == nil {
+				repetitions[i].CreatedAt = before.CreatedAt
+				err = recordChange(ctx, tx, *workout.ID, lifting.Updated, before, &repetitions[i])
+			}
 		}
 		if err != nil {
 			tx.Rollback()
-			return err
+			return translate(err)
 		}
 	}
 	return tx.Commit()
 }
 
-// Delete removes the corresponding database row
-func (s *LiftingStorage) Delete(id int) error {
-	tx, err := s.db.Beginx()
+// insertReturningID runs an insert ending in RETURNING id, returning the id
+// postgres assigned the row, since lib/pq doesn't support LastInsertId.
+func insertReturningID(ctx context.Context, tx *sqlx.Tx, query string, arg interface{}) (*int, error) {
+	stmt, err := tx.PrepareNamedContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var id int
+	err = stmt.GetContext(ctx, &id, arg)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// getInTx finds a repetition that isn't in the trash as part of a
+// transaction, ErrNotFound if there isn't one.
+func getInTx(ctx context.Context, tx *sqlx.Tx, id int) (*lifting.Repetition, error) {
+	stmt, err := tx.PrepareNamedContext(ctx, getByID)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	ws := []lifting.WorkoutRow{}
+	if err = stmt.SelectContext(ctx, &ws, byID{ID: id}); err != nil {
+		return nil, err
+	}
+	if len(ws) == 0 {
+		return nil, fmt.Errorf("repetition %d: %w", id, lifting.ErrNotFound)
+	}
+	rep, err := lifting.WorkoutToRepetition(ws[0])
+	if err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// recordChange adds a change to the log as part of the transaction making it,
+// and stamps the workout with it. If after is set, it's stamped too.
+func recordChange(ctx context.Context, tx *sqlx.Tx, id int, action lifting.Action, before, after *lifting.Repetition) error {
+	row, err := lifting.NewChangeRow(ctx, id, action, before, after)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, lockChanges); err != nil {
+		return err
+	}
+	seq, err := insertReturningID(ctx, tx, namedInsertChange, &row)
 	if err != nil {
 		return err
 	}
+	if _, err = tx.ExecContext(ctx, stamp, *seq, row.At, id); err != nil {
+		return err
+	}
+	lifting.Stamp(after, *seq, row.At)
+	return nil
+}
 
-	workout := lifting.WorkoutRow{ID: &id}
+// Delete moves the repetition to the trash.
+func (s *LiftingStorage) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
 
-	_, err = tx.NamedExec(
-		namedDelete,
-		workout,
-	)
+	before, err := getInTx(ctx, tx, id)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, trash, id)
+	}
+	if err == nil {
+		err = recordChange(ctx, tx, id, lifting.Deleted, before, nil)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore takes a repetition back out of the trash.
+func (s *LiftingStorage) Restore(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, restore, id)
+	if err == nil {
+		err = mustAffect(result, "deleted repetition", id)
+	}
+	var after *lifting.Repetition
+	if err == nil {
+		after, err = getInTx(ctx, tx, id)
+	}
+	if err == nil {
+		err = recordChange(ctx, tx, id, lifting.Restored, nil, after)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetChanges lists the changes made to a repetition, oldest first.
+func (s *LiftingStorage) GetChanges(ctx context.Context, id int) ([]lifting.Change, error) {
+	rows := []lifting.ChangeRow{}
+	if err := s.db.SelectContext(ctx, &rows, getChanges, id); err != nil {
+		return nil, err
+	}
+	return lifting.RowsToChanges(rows)
+}
+
+// trashedRow is a workout row along with when it was deleted.
+type trashedRow struct {
+	lifting.WorkoutRow
+	DeletedAt time.Time `db:"deleted_at"`
+}
+
+// GetTrash lists the repetitions in the trash, most recently deleted first.
+func (s *LiftingStorage) GetTrash(ctx context.Context) ([]lifting.Trashed, error) {
+	rows := []trashedRow{}
+	if err := s.db.SelectContext(ctx, &rows, getTrash); err != nil {
+		return nil, err
+	}
+
+	trashed := make([]lifting.Trashed, len(rows))
+	for i, row := range rows {
+		rep, err := lifting.WorkoutToRepetition(row.WorkoutRow)
+		if err != nil {
+			return nil, err
+		}
+		trashed[i] = lifting.Trashed{Repetition: rep, DeletedAt: row.DeletedAt}
+	}
+	return trashed, nil
+}
+
+// CountTrash counts the repetitions in the trash.
+func (s *LiftingStorage) CountTrash(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.GetContext(ctx, &count, countTrash)
+	return count, err
+}
+
+// Purge permanently removes the repetitions, and their tracks, that were put
+// in the trash by a time.
+func (s *LiftingStorage) Purge(ctx context.Context, before time.Time) (int, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, purgeTracks, before); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, purge, before)
 	if err != nil {
 		tx.Rollback()
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// AttachTrack stores the original track file for a repetition, replacing any
+// that was already attached.
+func (s *LiftingStorage) AttachTrack(ctx context.Context, track lifting.Track) error {
+	_, err := s.db.NamedExecContext(ctx, namedInsertTrack, &track)
+	return translate(err)
+}
+
+// LoadWithTrack inserts a repetition and attaches its track in one
+// transaction, so there's never one without the other.
+func (s *LiftingStorage) LoadWithTrack(ctx context.Context, repetition *lifting.Repetition, track lifting.Track) error {
+	workout, err := lifting.RepetitionToWorkout(*repetition)
+	if err != nil {
+		return err
+	}
+	workout.ID = nil
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
 		return err
 	}
 
+	id, err := insertReturningID(ctx, tx, namedInsert, &workout)
+	if err == nil {
+		repetition.ID = id
+		err = recordChange(ctx, tx, *id, lifting.Inserted, nil, repetition)
+	}
+	if err == nil {
+		track.RepetitionID = *id
+		_, err = tx.NamedExecContext(ctx, namedInsertTrack, &track)
+	}
+	if err != nil {
+		tx.Rollback()
+		repetition.ID = nil
+		return translate(err)
+	}
 	return tx.Commit()
 }
 
-func (s *LiftingStorage) getCollectionWithStruct(query string, arg interface{}) ([]lifting.Repetition, error) {
+// GetTrack retrieves the track attached to a repetition, ErrNotFound if there
+// is none.
+func (s *LiftingStorage) GetTrack(ctx context.Context, id int) (*lifting.Track, error) {
+	rows, err := s.db.NamedQueryContext(ctx, getTrack, byID{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("track for repetition %d: %w", id, lifting.ErrNotFound)
+	}
+	var track lifting.Track
+	err = rows.StructScan(&track)
+	if err != nil {
+		return nil, err
+	}
+	return &track, nil
+}
+
+func (s *LiftingStorage) getCollectionWithStruct(ctx context.Context, query string, arg interface{}) ([]lifting.Repetition, error) {
 	var (
 		rs []lifting.Repetition
 		w  lifting.WorkoutRow
 		r  lifting.Repetition
 	)
 
-	rows, err := s.db.NamedQuery(query, arg)
+	rows, err := s.db.NamedQueryContext(ctx, query, arg)
 	if err != nil {
-		panic(err)
+		return rs, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		err = rows.StructScan(&w)
@@ -226,13 +591,13 @@ func (s *LiftingStorage) getCollectionWithStruct(query string, arg interface{})
 		}
 
 	}
-	return rs, nil
+	return rs, rows.Err()
 }
 
 //GetUniqueCategories retrieves what categories have been input
-func (s *LiftingStorage) GetUniqueCategories() ([]string, error) {
+func (s *LiftingStorage) GetUniqueCategories(ctx context.Context) ([]string, error) {
 	categorys := make([]string, 0)
-	err := s.db.Select(&categorys, uniquecategory)
+	err := s.db.SelectContext(ctx, &categorys, uniquecategory)
 	if err != nil {
 		return categorys, err
 	}
@@ -240,9 +605,9 @@ func (s *LiftingStorage) GetUniqueCategories() ([]string, error) {
 }
 
 //GetUniqueUnits retrieves what categories have been input
-func (s *LiftingStorage) GetUniqueUnits() ([]string, error) {
+func (s *LiftingStorage) GetUniqueUnits(ctx context.Context) ([]string, error) {
 	categorys := make([]string, 0)
-	err := s.db.Select(&categorys, uniqueUnits)
+	err := s.db.SelectContext(ctx, &categorys, uniqueUnits)
 	if err != nil {
 		return categorys, err
 	}
@@ -250,9 +615,9 @@ func (s *LiftingStorage) GetUniqueUnits() ([]string, error) {
 }
 
 //GetUniqueExercises retrieves what Exercises have been input
-func (s *LiftingStorage) GetUniqueExercises() ([]string, error) {
+func (s *LiftingStorage) GetUniqueExercises(ctx context.Context) ([]string, error) {
 	r := make([]string, 0)
-	err := s.db.Select(&r, uniqueExercise)
+	err := s.db.SelectContext(ctx, &r, uniqueExercise)
 	if err != nil {
 		return r, err
 	}
@@ -260,27 +625,65 @@ func (s *LiftingStorage) GetUniqueExercises() ([]string, error) {
 }
 
 //GetByCategory retrieves reps in a given category
-func (s *LiftingStorage) GetByCategory(category string, count, offset int) ([]lifting.Repetition, error) {
-	return s.getCollectionWithStruct(getByCategory, lifting.CategoryQuery{
+func (s *LiftingStorage) GetByCategory(ctx context.Context, category string, count, offset int) ([]lifting.Repetition, error) {
+	return s.getCollectionWithStruct(ctx, getByCategory, lifting.CategoryQuery{
 		Category: category, Count: count, Offset: offset,
 	})
 }
 
-// GetLast retrieves data in order
-func (s *LiftingStorage) GetLast(count, offset int) ([]lifting.Repetition, error) {
-	return s.getCollectionWithStruct(getlast, pagination{Count: count, Offset: offset})
+// GetLast retrieves a page of the most recent repetitions, newest first,
+// starting from a cursor returned in a previous page, or the newest if empty.
+func (s *LiftingStorage) GetLast(ctx context.Context, count int, cursor string) (lifting.Result, error) {
+	return s.Search(ctx, lifting.Query{Count: count, Cursor: cursor})
+}
+
+// Search finds the repetitions matching the query, a page at a time.
+func (s *LiftingStorage) Search(ctx context.Context, q lifting.Query) (lifting.Result, error) {
+	statement, err := q.SQL(textSearch)
+	if err != nil {
+		return lifting.Result{}, err
+	}
+	// one extra tells us whether there's another page.
+	statement.Args["count"] = q.PageSize() + 1
+
+	reps, err := s.getCollectionWithStruct(ctx, fmt.Sprintf(search, statement.Where, statement.Order), statement.Args)
+	if err != nil {
+		return lifting.Result{}, err
+	}
+
+	behind := false
+	if statement.Behind != "" {
+		behind, err = s.exists(ctx, fmt.Sprintf(exists, statement.Behind), statement.Args)
+		if err != nil {
+			return lifting.Result{}, err
+		}
+	}
+	return lifting.NewResult(q, reps, behind)
+}
+
+// exists is true if the query finds anything.
+func (s *LiftingStorage) exists(ctx context.Context, query string, arg interface{}) (bool, error) {
+	stmt, err := s.db.PrepareNamedContext(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var found bool
+	err = stmt.GetContext(ctx, &found, arg)
+	return found, err
 }
 
 // GetByID finds a particular repetition
-func (s *LiftingStorage) GetByID(id int) (*lifting.Repetition, error) {
-	reps, err := s.getCollectionWithStruct(getByID, byID{ID: id})
+func (s *LiftingStorage) GetByID(ctx context.Context, id int) (*lifting.Repetition, error) {
+	reps, err := s.getCollectionWithStruct(ctx, getByID, byID{ID: id})
 
 	if err != nil {
 		return nil, err
 	}
 
 	if len(reps) == 0 {
-		return nil, nil
+		return nil, fmt.Errorf("repetition %d: %w", id, lifting.ErrNotFound)
 	}
 
 	if len(reps) > 1 {
@@ -290,13 +693,218 @@ func (s *LiftingStorage) GetByID(id int) (*lifting.Repetition, error) {
 	return &reps[0], nil
 }
 
+// GetByClientID finds the repetition stored with the client ID, even in the
+// trash.
+func (s *LiftingStorage) GetByClientID(ctx context.Context, clientID string) (*lifting.Repetition, error) {
+	reps, err := s.getCollectionWithStruct(ctx, getByClientID, byClientID{ClientID: clientID})
+	if err != nil {
+		return nil, err
+	}
+	if len(reps) == 0 {
+		return nil, fmt.Errorf("repetition with client ID %q: %w", clientID, lifting.ErrNotFound)
+	}
+	return &reps[0], nil
+}
+
 // GetBetween returns the reps between the start and end date.
-func (s *LiftingStorage) GetBetween(start, end civil.Date) ([]lifting.Repetition, error) {
-	return s.getCollectionWithStruct(getBetween, between{Start: start, End: end})
+func (s *LiftingStorage) GetBetween(ctx context.Context, start, end civil.Date) ([]lifting.Repetition, error) {
+	return s.getCollectionWithStruct(ctx, getBetween, between{Start: start.String(), End: end.String()})
 }
 
-func checkErr(err error) {
+// CountBetween counts the reps between the start and end date.
+func (s *LiftingStorage) CountBetween(ctx context.Context, start, end civil.Date) (int, error) {
+	var count int
+	err := s.db.GetContext(ctx, &count, countBetween, start.String(), end.String())
+	return count, err
+}
+
+// mustAffect turns an update or delete that didn't touch a row into
+// lifting.ErrNotFound.
+func mustAffect(result sql.Result, what string, id int) error {
+	n, err := result.RowsAffected()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %d: %w", what, id, lifting.ErrNotFound)
+	}
+	return nil
+}
+
+// The postgres error codes for clashing with what's already stored.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// translate turns violations of unique and foreign key constraints into
+// lifting.ErrConflict.
+func translate(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case uniqueViolation, foreignKeyViolation:
+			return fmt.Errorf("%w: %v", lifting.ErrConflict, err)
+		}
+	}
+	return err
+}
+
+// LoadMeasurements inserts or updates the measurements, setting the ID of any
+// that were newly inserted.
+func (s *LiftingStorage) LoadMeasurements(ctx context.Context, measurements []lifting.Measurement) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = loadMeasurements(ctx, tx, measurements); err != nil {
+		tx.Rollback()
+		return translate(err)
+	}
+	return tx.Commit()
+}
+
+// loadMeasurements is LoadMeasurements as part of a transaction.
+func loadMeasurements(ctx context.Context, tx *sqlx.Tx, measurements []lifting.Measurement) error {
+	for i, m := range measurements {
+		row, err := lifting.MeasurementToRow(m)
+		if err != nil {
+			return err
+		}
+
+		if row.ID == nil {
+			measurements[i].ID, err = insertReturningID(ctx, tx, namedInsertMeasurement, &row)
+		} else {
+			var result sql.Result
+			result, err = tx.NamedExecContext(ctx, namedUpdateMeasurement, &row)
+			if err == nil {
+				err = mustAffect(result, "measurement", *row.ID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMeasurements retrieves the measurements of a kind taken between the start
+// and end dates, oldest first. An empty kind retrieves every kind.
+func (s *LiftingStorage) GetMeasurements(ctx context.Context, kind string, start, end civil.Date) ([]lifting.Measurement, error) {
+	ms := make([]lifting.Measurement, 0)
+
+	rows, err := s.db.NamedQueryContext(ctx, getMeasurements, lifting.MeasurementQuery{
+		Kind: kind, Start: start.String(), End: end.String(),
+	})
+	if err != nil {
+		return ms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row lifting.MeasurementRow
+		err = rows.StructScan(&row)
+		if err != nil {
+			return ms, err
+		}
+		m, err := lifting.RowToMeasurement(row)
+		if err != nil {
+			return ms, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, rows.Err()
+}
+
+// DeleteMeasurement removes the corresponding measurement
+func (s *LiftingStorage) DeleteMeasurement(ctx context.Context, id int) error {
+	result, err := s.db.NamedExecContext(ctx, namedDeleteMeasurement, lifting.MeasurementRow{ID: &id})
+	if err != nil {
+		return err
+	}
+	return mustAffect(result, "measurement", id)
+}
+
+// ChangesSince lists the changes after the one with the sequence number seq,
+// oldest first, at most lifting.ChangeFeedPage of them. The changes are
+// committed in order, see lockChanges, so none will turn up later behind the
+// last one listed.
+func (s *LiftingStorage) ChangesSince(ctx context.Context, seq int) ([]lifting.Change, error) {
+	rows := []lifting.ChangeRow{}
+	if err := s.db.SelectContext(ctx, &rows, changesSince, seq, lifting.ChangeFeedPage); err != nil {
+		return nil, err
+	}
+	return lifting.RowsToChanges(rows)
+}
+
+// LoadBackup loads a backup into the empty database in one transaction, so
+// either all of it is restored or none of it is. The repetitions get new IDs
+// but keep when they were created, updated and deleted, and the change log
+// starts again with them being inserted.
+func (s *LiftingStorage) LoadBackup(ctx context.Context, backup lifting.Backup) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = loadBackup(ctx, tx, backup); err != nil {
+		tx.Rollback()
+		return translate(err)
+	}
+	return tx.Commit()
+}
+
+func loadBackup(ctx context.Context, tx *sqlx.Tx, backup lifting.Backup) error {
+	var used bool
+	if err := tx.GetContext(ctx, &used, fmt.Sprintf(exists, "")); err != nil {
+		return err
+	}
+	if used {
+		return fmt.Errorf("%w: can only restore a backup into an empty log", lifting.ErrConflict)
+	}
+
+	// the backed up IDs map to the ones the repetitions get now.
+	ids := make(map[int]int, len(backup.Repetitions))
+	for i, r := range backup.Repetitions {
+		rep := r.Repetition
+		rep.ID = nil
+		workout, err := lifting.RepetitionToWorkout(rep)
+		if err != nil {
+			return lifting.InvalidAt(err, i)
+		}
+		if rep.ID, err = insertReturningID(ctx, tx, namedInsert, &workout); err != nil {
+			return err
+		}
+		if err = recordChange(ctx, tx, *rep.ID, lifting.Inserted, nil, &rep); err != nil {
+			return err
+		}
+
+		created := sql.NullTime{Time: r.CreatedAt, Valid: !r.CreatedAt.IsZero()}
+		updated := sql.NullTime{Time: r.UpdatedAt, Valid: !r.UpdatedAt.IsZero()}
+		if _, err = tx.ExecContext(ctx, restoreStamps, created, updated, r.DeletedAt, *rep.ID); err != nil {
+			return err
+		}
+		if r.ID != nil {
+			ids[*r.ID] = *rep.ID
+		}
+	}
+
+	for _, t := range backup.Tracks {
+		id, ok := ids[t.RepetitionID]
+		if !ok {
+			return fmt.Errorf("%w: track for repetition %d, which isn't in the backup", lifting.ErrInvalidBackup, t.RepetitionID)
+		}
+		t.RepetitionID = id
+		if _, err := tx.NamedExecContext(ctx, namedInsertTrack, &t); err != nil {
+			return err
+		}
+	}
+
+	measurements := make([]lifting.Measurement, len(backup.Measurements))
+	for i, m := range backup.Measurements {
+		m.ID = nil
+		measurements[i] = m
 	}
+	return loadMeasurements(ctx, tx, measurements)
 }
@@ -1,7 +1,9 @@
 package postgres
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"testing"
 
 	"cloud.google.com/go/civil"
@@ -9,8 +11,9 @@ import (
 )
 
 func TestLiftingStorage(t *testing.T) {
-	storage, err := CreateStorage("user=testing dbname=test_lifting password=testing", nil)
-	//defer storage.Drop()
+	backend, err := CreateStorage("user=testing dbname=test_lifting password=testing", nil)
+	//defer backend.Drop()
+	storage := lifting.Adapt(backend)
 	if err != nil {
 		t.Error(err)
 	}
@@ -86,12 +89,13 @@ func TestLiftingStorage(t *testing.T) {
 		return
 	}
 
-	last, err := storage.GetLast(1, 0)
+	result, err := storage.GetLast(1, "")
 
 	if err != nil {
 		t.Fatal(err)
 		return
 	}
+	last := result.Repetitions
 
 	expected := reps[len(reps)-1]
 	if len(last) == 0 {
@@ -197,3 +201,79 @@ func TestLiftingStorage(t *testing.T) {
 	}
 
 }
+
+// TestChangesSinceConcurrent has a consumer follow the change feed while
+// repetitions are stored concurrently, and checks it saw every change, none
+// committing behind one it had already been given.
+func TestChangesSinceConcurrent(t *testing.T) {
+	ctx := context.Background()
+	backend, err := CreateStorage("user=testing dbname=test_lifting password=testing", nil)
+	if err != nil {
+		t.Skip("no database to test against", err)
+	}
+
+	// start from the end of the existing feed.
+	last := 0
+	for {
+		changes, err := backend.ChangesSince(ctx, last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) == 0 {
+			break
+		}
+		last = changes[len(changes)-1].ID
+	}
+	start := last
+
+	var writers sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			reps := []lifting.Repetition{{Exercise: "squat", Volume: 5, Weight: 100 + i, SessionDate: civil.Date{Year: 2018, Month: 12, Day: 27}, Units: "lbs"}}
+			if err := backend.Load(ctx, reps); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		writers.Wait()
+		close(done)
+	}()
+
+	seen := make(map[int]bool)
+	follow := func() {
+		changes, err := backend.ChangesSince(ctx, last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range changes {
+			seen[c.ID] = true
+			last = c.ID
+		}
+	}
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		follow()
+	}
+	follow()
+
+	all, err := backend.ChangesSince(ctx, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 20 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 20), fmt.Sprintf("found %#v", len(all)))
+	}
+	for _, c := range all {
+		if !seen[c.ID] {
+			t.Fatal("the consumer missed change", c.ID)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package lifting
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Sort is the order search results come back in.
+type Sort string
+
+// The orders we know how to page through.
+const (
+	Newest   Sort = "newest"
+	Oldest   Sort = "oldest"
+	Heaviest Sort = "heaviest"
+	Hardest  Sort = "hardest"
+)
+
+// Query filters, sorts and pages through repetitions. Zero values don't
+// filter anything.
+type Query struct {
+	Exercises  []string
+	Categories []string
+	Units      []string
+	// Effort and weight ranges are inclusive, a zero max is unbounded.
+	MinEffort, MaxEffort int
+	MinWeight, MaxWeight int
+	// FailureOnly finds the sets you failed.
+	FailureOnly bool
+	// Text searches the comments.
+	Text  string
+	Sort  Sort
+	Count int
+	// Cursor is the Next token from a previous Result, to get the page after it.
+	Cursor string
+}
+
+// DefaultPageSize is how many repetitions a query returns if it doesn't say.
+const DefaultPageSize = 50
+
+// PageSize is how many repetitions the query should return.
+func (q Query) PageSize() int {
+	if q.Count <= 0 {
+		return DefaultPageSize
+	}
+	return q.Count
+}
+
+// Result is a page of repetitions matching a query.
+type Result struct {
+	Repetitions []Repetition
+	// Next is the cursor for the following page, empty if this is the last.
+	Next string
+	// Previous is the cursor for the page before, empty if this is the first.
+	Previous string
+}
+
+// NewResult makes a page of results for the query out of the repetitions a
+// backend found. Backends fetch one more than the page size so we know if
+// there's another page in the direction we're going, and check whether there
+// is anything behind the cursor (see QuerySQL.Behind) for the other direction.
+func NewResult(q Query, reps []Repetition, behind bool) (Result, error) {
+	sort, err := ParseSort(string(q.Sort))
+	if err != nil {
+		return Result{}, err
+	}
+	var cursor Cursor
+	if q.Cursor != "" {
+		if cursor, err = DecodeCursor(q.Cursor); err != nil {
+			return Result{}, err
+		}
+	}
+
+	more := len(reps) > q.PageSize()
+	if more {
+		reps = reps[:q.PageSize()]
+	}
+
+	hasNext, hasPrevious := more, behind
+	if cursor.Backward {
+		// fetched in reverse, put them back in order.
+		for i, j := 0, len(reps)-1; i < j; i, j = i+1, j-1 {
+			reps[i], reps[j] = reps[j], reps[i]
+		}
+		hasNext, hasPrevious = behind, more
+	}
+
+	result := Result{Repetitions: reps}
+	if len(reps) == 0 {
+		return result, nil
+	}
+	if hasNext {
+		result.Next = sort.CursorFor(reps[len(reps)-1]).Encode()
+	}
+	if hasPrevious {
+		previous := sort.CursorFor(reps[0])
+		previous.Backward = true
+		result.Previous = previous.Encode()
+	}
+	return result, nil
+}
+
+// Cursor marks a position in the results of a query: the sort key of the last
+// repetition on a page, or the first if we're going backwards. It is handed
+// out as an opaque token.
+type Cursor struct {
+	Value    float64 `json:"v,omitempty"`
+	Date     string  `json:"d"`
+	ID       int     `json:"i"`
+	Backward bool    `json:"b,omitempty"`
+}
+
+// Encode makes the cursor into a token for a url.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor reads a cursor back out of a token.
+func DecodeCursor(token string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, fmt.Errorf("%w: bad cursor %q", ErrInvalidQuery, token)
+	}
+	if err = json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%w: bad cursor %q", ErrInvalidQuery, token)
+	}
+	return c, nil
+}
+
+// ParseSort reads a sort order, defaulting to Newest.
+func ParseSort(s string) (Sort, error) {
+	switch Sort(s) {
+	case "":
+		return Newest, nil
+	case Newest, Oldest, Heaviest, Hardest:
+		return Sort(s), nil
+	}
+	return "", fmt.Errorf("%w: unknown sort %q, expected newest, oldest, heaviest or hardest", ErrInvalidQuery, s)
+}
+
+// sortValue is the column a sort orders by ahead of the date, if any.
+func (s Sort) sortValue() string {
+	switch s {
+	case Heaviest:
+		return "COALESCE(weight, 0)"
+	case Hardest:
+		return "COALESCE(effort, 0)"
+	}
+	return ""
+}
+
+// CursorFor is the cursor pointing just after the repetition in a query
+// sorted by s.
+func (s Sort) CursorFor(r Repetition) Cursor {
+	c := Cursor{Date: r.SessionDate.String()}
+	if r.ID != nil {
+		c.ID = *r.ID
+	}
+	switch s {
+	case Heaviest:
+		c.Value = float64(r.Weight)
+	case Hardest:
+		c.Value = float64(r.Effort)
+	}
+	return c
+}
+
+func inList(column, name string, values []string, args map[string]interface{}) string {
+	params := make([]string, len(values))
+	for i, v := range values {
+		param := fmt.Sprintf("%s%d", name, i)
+		params[i] = ":" + param
+		args[param] = v
+	}
+	return fmt.Sprintf("%s IN (%s)", column, strings.Join(params, ", "))
+}
+
+// QuerySQL is the SQL for a query, with named arguments for sqlx.
+type QuerySQL struct {
+	Where, Order string
+	// Behind is a WHERE clause selecting what's on the far side of the
+	// cursor, the way we came from, empty if there's no cursor.
+	Behind string
+	Args   map[string]interface{}
+}
+
+// SQL builds the clauses for the query. Backends search comments
+// differently, so they pass the condition to use, which can refer to the :text
+// argument.
+func (q Query) SQL(textSearch string) (QuerySQL, error) {
+	sort, err := ParseSort(string(q.Sort))
+	if err != nil {
+		return QuerySQL{}, err
+	}
+
+	args := make(map[string]interface{})
+	// nothing in the trash turns up in a search.
+	conditions := []string{"deleted_at IS NULL"}
+
+	if len(q.Exercises) > 0 {
+		conditions = append(conditions, inList("exercise", "exercise", q.Exercises, args))
+	}
+	if len(q.Categories) > 0 {
+		conditions = append(conditions, inList("category", "category", q.Categories, args))
+	}
+	if len(q.Units) > 0 {
+		conditions = append(conditions, inList("units", "units", q.Units, args))
+	}
+	if q.MinEffort > 0 {
+		conditions = append(conditions, "effort >= :min_effort")
+		args["min_effort"] = q.MinEffort
+	}
+	if q.MaxEffort > 0 {
+		conditions = append(conditions, "effort <= :max_effort")
+		args["max_effort"] = q.MaxEffort
+	}
+	if q.MinWeight > 0 {
+		conditions = append(conditions, "weight >= :min_weight")
+		args["min_weight"] = q.MinWeight
+	}
+	if q.MaxWeight > 0 {
+		conditions = append(conditions, "weight <= :max_weight")
+		args["max_weight"] = q.MaxWeight
+	}
+	if q.FailureOnly {
+		conditions = append(conditions, "failure")
+	}
+	if q.Text != "" {
+		conditions = append(conditions, textSearch)
+		args["text"] = q.Text
+	}
+
+	var cursor Cursor
+	if q.Cursor != "" {
+		if cursor, err = DecodeCursor(q.Cursor); err != nil {
+			return QuerySQL{}, err
+		}
+	}
+
+	// going backwards we fetch in the opposite order and flip the page after.
+	descending := sort != Oldest
+	if cursor.Backward {
+		descending = !descending
+	}
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	statement := QuerySQL{Args: args}
+
+	if q.Cursor != "" {
+		args["cursor_date"] = cursor.Date
+		args["cursor_id"] = cursor.ID
+		keyset := fmt.Sprintf(
+			"(session_date %[1]s :cursor_date OR (session_date = :cursor_date AND id %[1]s :cursor_id))",
+			comparison,
+		)
+		if value := sort.sortValue(); value != "" {
+			args["cursor_value"] = cursor.Value
+			keyset = fmt.Sprintf("(%[1]s %[2]s :cursor_value OR (%[1]s = :cursor_value AND %[3]s))",
+				value, comparison, keyset)
+		}
+		behind := append(append([]string(nil), conditions...), "NOT "+keyset)
+		statement.Behind = "WHERE " + strings.Join(behind, " AND ")
+		conditions = append(conditions, keyset)
+	}
+
+	statement.Where = "WHERE " + strings.Join(conditions, " AND ")
+
+	statement.Order = fmt.Sprintf("ORDER BY session_date %[1]s, id %[1]s", direction)
+	if value := sort.sortValue(); value != "" {
+		statement.Order = fmt.Sprintf("ORDER BY %s %s, session_date %s, id %s", value, direction, direction, direction)
+	}
+
+	return statement, nil
+}
@@ -0,0 +1,152 @@
+package lifting
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Middleware wraps a handler to do something for every request, like logging
+// it or checking who sent it.
+type Middleware func(http.Handler) http.Handler
+
+// Router sends requests to handlers by method and path. A pattern is a path
+// whose {name} segments match any one segment, read with Param. Trailing
+// slashes don't matter, and a GET route answers HEAD too. A path with a route
+// but not for the method gets 405 with the methods it has in the Allow header.
+type Router struct {
+	routes     []*route
+	middleware []Middleware
+	// NotFound handles paths no route matches, http.NotFound if nil.
+	NotFound http.Handler
+}
+
+type route struct {
+	pattern  []string
+	handlers map[string]http.Handler
+}
+
+type (
+	paramsKey struct{}
+	routeKey  struct{}
+)
+
+// Route is the pattern of the route the request matched, e.g. "/edit/{id}",
+// empty if it didn't match one.
+func Route(r *http.Request) string {
+	pattern, _ := r.Context().Value(routeKey{}).(string)
+	return pattern
+}
+
+// Param is the segment of the path that matched {name} in the route's
+// pattern, empty if there's no such segment.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func segments(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// match is the parameters if the path matches the route, ok false if it
+// doesn't.
+func (rt *route) match(path []string) (params map[string]string, ok bool) {
+	if len(path) != len(rt.pattern) {
+		return nil, false
+	}
+	params = make(map[string]string)
+	for i, segment := range rt.pattern {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if path[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = path[i]
+			continue
+		}
+		if segment != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// allowed lists the methods the route has, for the Allow header.
+func (rt *route) allowed() string {
+	methods := make([]string, 0, len(rt.handlers)+1)
+	for method := range rt.handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := rt.handlers[http.MethodGet]; ok {
+		if _, ok = rt.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// Handle routes requests with the method to the pattern to the handler.
+func (router *Router) Handle(method, pattern string, handler http.Handler) {
+	path := segments(pattern)
+	for _, rt := range router.routes {
+		if strings.Join(rt.pattern, "/") == strings.Join(path, "/") {
+			rt.handlers[method] = handler
+			return
+		}
+	}
+	router.routes = append(router.routes, &route{
+		pattern:  path,
+		handlers: map[string]http.Handler{method: handler},
+	})
+}
+
+// HandleFunc routes requests with the method to the pattern to the function.
+func (router *Router) HandleFunc(method, pattern string, handler http.HandlerFunc) {
+	router.Handle(method, pattern, handler)
+}
+
+// Use runs middleware around every request, including the ones that aren't
+// found or not allowed. The first used is the outermost.
+func (router *Router) Use(middleware ...Middleware) {
+	router.middleware = append(router.middleware, middleware...)
+}
+
+// ServeHTTP routes a request.
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, rt, params := router.lookup(r)
+	if rt != nil {
+		ctx := context.WithValue(r.Context(), paramsKey{}, params)
+		r = r.WithContext(context.WithValue(ctx, routeKey{}, "/"+strings.Join(rt.pattern, "/")))
+	}
+	for i := len(router.middleware) - 1; i >= 0; i-- {
+		handler = router.middleware[i](handler)
+	}
+	handler.ServeHTTP(w, r)
+}
+
+func (router *Router) lookup(r *http.Request) (http.Handler, *route, map[string]string) {
+	path := segments(r.URL.Path)
+	for _, rt := range router.routes {
+		params, ok := rt.match(path)
+		if !ok {
+			continue
+		}
+		if handler, ok := rt.handlers[r.Method]; ok {
+			return handler, rt, params
+		}
+		if handler, ok := rt.handlers[http.MethodGet]; ok && r.Method == http.MethodHead {
+			return handler, rt, params
+		}
+		allow := rt.allowed()
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", allow)
+			http.Error(w, "Unexpected method", http.StatusMethodNotAllowed)
+		}), rt, params
+	}
+	if router.NotFound != nil {
+		return router.NotFound, nil, nil
+	}
+	return http.HandlerFunc(http.NotFound), nil, nil
+}
@@ -0,0 +1,65 @@
+package lifting
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	var seen []string
+	router := &Router{}
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, "outer")
+			next.ServeHTTP(w, r)
+		})
+	}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, "inner")
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.HandleFunc("GET", "/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "index")
+	})
+	router.HandleFunc("GET", "/edit/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "edit ", Param(r, "id"))
+	})
+	router.HandleFunc("POST", "/edit/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
+	for _, c := range []struct {
+		method, path string
+		code         int
+		body, allow  string
+	}{
+		{"GET", "/", http.StatusOK, "index", ""},
+		{"GET", "/edit/3", http.StatusOK, "edit 3", ""},
+		{"GET", "/edit/3/", http.StatusOK, "edit 3", ""},
+		{"HEAD", "/edit/3", http.StatusOK, "edit 3", ""},
+		{"POST", "/edit/3", http.StatusSeeOther, "", ""},
+		{"PUT", "/edit/3", http.StatusMethodNotAllowed, "", "GET, HEAD, POST"},
+		{"POST", "/", http.StatusMethodNotAllowed, "", "GET, HEAD"},
+		{"GET", "/edit/", http.StatusNotFound, "", ""},
+		{"GET", "/edit/3/more", http.StatusNotFound, "", ""},
+	} {
+		seen = nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.code {
+			t.Fatal("mimsatch", c.method, c.path, fmt.Sprintf("expected %#v", c.code), fmt.Sprintf("found %#v", w.Code))
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Fatal("mimsatch", c.method, c.path, fmt.Sprintf("expected %#v", c.body), fmt.Sprintf("found %#v", w.Body.String()))
+		}
+		if allow := w.Header().Get("Allow"); allow != c.allow {
+			t.Fatal("mimsatch", c.method, c.path, fmt.Sprintf("expected %#v", c.allow), fmt.Sprintf("found %#v", allow))
+		}
+		if len(seen) != 2 || seen[0] != "outer" || seen[1] != "inner" {
+			t.Fatal("expected the middleware around", c.method, c.path, seen)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package lifting
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/civil"
+)
+
+// Sex picks which set of coefficients the powerlifting formulas use.
+type Sex string
+
+// The sexes the scoring formulas are defined for.
+const (
+	Male   Sex = "male"
+	Female Sex = "female"
+)
+
+// ParseSex reads a sex from user input, e.g. "m" or "Female".
+func ParseSex(s string) (Sex, error) {
+	switch strings.ToLower(s) {
+	case "m", "male", "man":
+		return Male, nil
+	case "f", "female", "woman":
+		return Female, nil
+	}
+	return "", fmt.Errorf("unknown sex %q, expected male or female", s)
+}
+
+func clamp(x, min, max float64) float64 {
+	return math.Max(min, math.Min(max, x))
+}
+
+// polynomial evaluates the coefficients, lowest order first, at x.
+func polynomial(coefficients []float64, x float64) float64 {
+	total, power := 0.0, 1.0
+	for _, c := range coefficients {
+		total += c * power
+		power *= x
+	}
+	return total
+}
+
+var (
+	wilksMale = []float64{
+		-216.0475144, 16.2606339, -0.002388645, -0.00113732, 7.01863e-06, -1.291e-08,
+	}
+	wilksFemale = []float64{
+		594.31747775582, -27.23842536447, 0.82112226871, -0.00930733913, 4.731582e-05, -9.054e-08,
+	}
+	dotsMale = []float64{
+		-307.75076, 24.0900756, -0.1918759221, 0.0007391293, -0.000001093,
+	}
+	dotsFemale = []float64{
+		-57.96288, 13.6175032, -0.1126655495, 0.0005158568, -0.0000010706,
+	}
+)
+
+// Wilks scores the kilograms lifted by a lifter of the given bodyweight in kg,
+// using the original Wilks coefficients.
+func Wilks(sex Sex, bodyweight, lifted float64) float64 {
+	if sex == Female {
+		return lifted * 500 / polynomial(wilksFemale, clamp(bodyweight, 26.51, 154.53))
+	}
+	return lifted * 500 / polynomial(wilksMale, clamp(bodyweight, 40, 201.9))
+}
+
+// DOTS scores the kilograms lifted by a lifter of the given bodyweight in kg.
+func DOTS(sex Sex, bodyweight, lifted float64) float64 {
+	if sex == Female {
+		return lifted * 500 / polynomial(dotsFemale, clamp(bodyweight, 40, 150))
+	}
+	return lifted * 500 / polynomial(dotsMale, clamp(bodyweight, 40, 210))
+}
+
+var (
+	ipfGLMale   = [3]float64{1199.72839, 1025.18162, 0.00921}
+	ipfGLFemale = [3]float64{610.32796, 1045.59282, 0.03048}
+)
+
+// IPFGL scores a classic (raw) squat, bench and deadlift total in kg by a
+// lifter of the given bodyweight in kg, using the IPF GL formula.
+func IPFGL(sex Sex, bodyweight, total float64) float64 {
+	c := ipfGLMale
+	if sex == Female {
+		c = ipfGLFemale
+	}
+	if bodyweight < 35 {
+		return 0
+	}
+	return total * 100 / (c[0] - c[1]*math.Exp(-c[2]*bodyweight))
+}
+
+// Lift is one of the three competition lifts.
+type Lift string
+
+// The competition lifts.
+const (
+	Squat    Lift = "squat"
+	Bench    Lift = "bench"
+	Deadlift Lift = "deadlift"
+)
+
+// CompetitionLifts maps how exercises are named in the log onto the
+// competition lift they count as. Anything not in here doesn't count.
+var CompetitionLifts = map[string]Lift{
+	"squat":                 Squat,
+	"back squat":            Squat,
+	"low bar squat":         Squat,
+	"high bar squat":        Squat,
+	"bench":                 Bench,
+	"bench press":           Bench,
+	"deadlift":              Deadlift,
+	"conventional deadlift": Deadlift,
+	"sumo deadlift":         Deadlift,
+}
+
+// Total is the best squat, bench and deadlift over a window of days, scored
+// against your bodyweight at the end of it.
+type Total struct {
+	Start, End civil.Date
+	// Best is the heaviest successful repetition of each lift.
+	Best map[Lift]Repetition
+	// Squat, Bench, Deadlift, Total and Bodyweight are in kg.
+	Squat, Bench, Deadlift float64
+	Total                  float64
+	Bodyweight             float64
+	// Wilks, DOTS and IPFGL are zero if we don't know your bodyweight or sex.
+	Wilks, DOTS, IPFGL float64
+}
+
+// Complete is true if the total has all three lifts.
+func (t Total) Complete() bool {
+	return t.Squat > 0 && t.Bench > 0 && t.Deadlift > 0
+}
+
+// BestTotal totals the heaviest successful squat, bench and deadlift done
+// between start and end, whatever the reps.
+func BestTotal(reps []Repetition, bodyweights Bodyweights, sex Sex, start, end civil.Date) Total {
+	t := Total{Start: start, End: end, Best: make(map[Lift]Repetition)}
+	best := map[Lift]*float64{Squat: &t.Squat, Bench: &t.Bench, Deadlift: &t.Deadlift}
+
+	for _, r := range reps {
+		lift, ok := CompetitionLifts[strings.ToLower(r.Exercise)]
+		if !ok || r.Failure || r.SessionDate.Before(start) || r.SessionDate.After(end) {
+			continue
+		}
+		kg, err := massIn(float64(r.Weight), r.Units, "kg")
+		if err != nil {
+			continue
+		}
+		if kg > *best[lift] {
+			*best[lift] = kg
+			t.Best[lift] = r
+		}
+	}
+
+	t.Total = t.Squat + t.Bench + t.Deadlift
+
+	bw, ok := bodyweights.On(end)
+	if !ok {
+		return t
+	}
+	bwKg, err := massIn(bw.Value, bw.Units, "kg")
+	if err != nil || bwKg <= 0 {
+		return t
+	}
+	t.Bodyweight = bwKg
+	if sex == "" {
+		return t
+	}
+	t.Wilks = Wilks(sex, bwKg, t.Total)
+	t.DOTS = DOTS(sex, bwKg, t.Total)
+	t.IPFGL = IPFGL(sex, bwKg, t.Total)
+	return t
+}
+
+// ScoreHistory scores your best total over the trailing window of days
+// ending on each day you did a competition lift, oldest first. Days without
+// all three lifts in the window are left out.
+func ScoreHistory(reps []Repetition, bodyweights Bodyweights, sex Sex, window int) []Total {
+	days := make(map[civil.Date]bool)
+	for _, r := range reps {
+		if _, ok := CompetitionLifts[strings.ToLower(r.Exercise)]; ok {
+			days[r.SessionDate] = true
+		}
+	}
+
+	history := make([]Total, 0, len(days))
+	for day := range days {
+		t := BestTotal(reps, bodyweights, sex, day.AddDays(1-window), day)
+		if t.Complete() {
+			history = append(history, t)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].End.Before(history[j].End)
+	})
+	return history
+}
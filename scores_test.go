@@ -0,0 +1,77 @@
+package lifting
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"cloud.google.com/go/civil"
+)
+
+func TestBestTotal(t *testing.T) {
+	bodyweights := NewBodyweights([]Measurement{
+		Measurement{Kind: Bodyweight, Value: 100, Units: "kg", Date: civil.Date{Year: 2018, Month: 11, Day: 1}},
+	})
+
+	reps := []Repetition{
+		Repetition{
+			Exercise:    "squat",
+			Weight:      250,
+			Units:       "kg",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 3},
+		},
+		Repetition{
+			Exercise:    "Bench Press",
+			Weight:      330,
+			Units:       "lbs",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 5},
+		},
+		Repetition{
+			Exercise:    "deadlift",
+			Weight:      320,
+			Units:       "kg",
+			Failure:     true,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 7},
+		},
+		Repetition{
+			Exercise:    "sumo deadlift",
+			Weight:      300,
+			Units:       "kg",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 7},
+		},
+		Repetition{
+			Exercise:    "front squat",
+			Weight:      260,
+			Units:       "kg",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 7},
+		},
+	}
+
+	total := BestTotal(reps, bodyweights, Male,
+		civil.Date{Year: 2018, Month: 12, Day: 1}, civil.Date{Year: 2018, Month: 12, Day: 31})
+
+	if total.Squat != 250 || total.Deadlift != 300 || math.Abs(total.Bench-149.7) > 0.1 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", total))
+	}
+	if !total.Complete() || total.Bodyweight != 100 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", total))
+	}
+
+	// a 700kg total at 100kg
+	if math.Abs(total.IPFGL/total.Total*700-88.43) > 0.01 {
+		t.Fatal("unexpected ipf gl", total.IPFGL)
+	}
+	if math.Abs(total.Wilks/total.Total-0.6086) > 0.0001 {
+		t.Fatal("unexpected wilks", total.Wilks)
+	}
+
+	// the squat is too long before the deadlift to count in a three day window.
+	if history := ScoreHistory(reps, bodyweights, Male, 3); len(history) != 0 {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", history))
+	}
+
+	history := ScoreHistory(reps, bodyweights, Male, 5)
+	if len(history) != 1 || history[0].End != (civil.Date{Year: 2018, Month: 12, Day: 7}) {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", history))
+	}
+}
@@ -0,0 +1,202 @@
+package lifting
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ServerConfig is how to run the web server.
+type ServerConfig struct {
+	// Addr is the address to listen on, e.g. ":9000".
+	Addr string
+	// StaticDir holds the stylesheets and scripts and TemplateDir the
+	// templates, the ones built in if empty.
+	StaticDir, TemplateDir string
+	// Dev reloads the templates from TemplateDir for every page, so edits
+	// show without a restart.
+	Dev bool
+	// PageSize is how many repetitions a page of history shows.
+	PageSize int
+	// CertFile and KeyFile serve HTTPS if they're both set.
+	CertFile, KeyFile string
+	// ReadTimeout and WriteTimeout limit how long reading a request and
+	// writing its response can take, no limit if zero.
+	ReadTimeout, WriteTimeout time.Duration
+	// RequestTimeout limits how long a request's storage calls can take.
+	RequestTimeout time.Duration
+	// ShutdownTimeout is how long requests in flight get to finish once the
+	// server is stopping.
+	ShutdownTimeout time.Duration
+	// Retention is how long deleted repetitions are kept in the trash.
+	Retention time.Duration
+	// Logger gets the access log and what the server's doing,
+	// slog.Default() if nil.
+	Logger *slog.Logger
+}
+
+// AddFlags adds a flag to flags for each of the config's settings, defaulting
+// to the LIFT_* environment variable named in its usage, so `lift serve` and
+// the web binary are configured the same way.
+func (config *ServerConfig) AddFlags(flags *flag.FlagSet) {
+	flags.StringVar(&config.Addr, "addr", envString("LIFT_ADDR", ":9000"), "address to listen on, LIFT_ADDR")
+	flags.StringVar(&config.StaticDir, "static", os.Getenv("LIFT_STATIC"), "directory of stylesheets, the built in ones if empty, LIFT_STATIC")
+	flags.StringVar(&config.TemplateDir, "templates", os.Getenv("LIFT_TEMPLATES"), "directory of templates, the built in ones if empty, LIFT_TEMPLATES")
+	flags.BoolVar(&config.Dev, "dev", false, "reload the templates from the templates directory for every page")
+	flags.IntVar(&config.PageSize, "page-size", envInt("LIFT_PAGE_SIZE", 10), "workouts to a page, LIFT_PAGE_SIZE")
+	flags.StringVar(&config.CertFile, "tls-cert", os.Getenv("LIFT_TLS_CERT"), "certificate file, to serve https, LIFT_TLS_CERT")
+	flags.StringVar(&config.KeyFile, "tls-key", os.Getenv("LIFT_TLS_KEY"), "key file for the certificate, LIFT_TLS_KEY")
+	flags.DurationVar(&config.ReadTimeout, "read-timeout", envDuration("LIFT_READ_TIMEOUT", 30*time.Second), "longest to read a request, 0 for no limit, LIFT_READ_TIMEOUT")
+	flags.DurationVar(&config.WriteTimeout, "write-timeout", envDuration("LIFT_WRITE_TIMEOUT", 30*time.Second), "longest to write a response, 0 for no limit, LIFT_WRITE_TIMEOUT")
+	flags.DurationVar(&config.RequestTimeout, "request-timeout", envDuration("LIFT_REQUEST_TIMEOUT", 10*time.Second), "longest a request may spend on the database, LIFT_REQUEST_TIMEOUT")
+	flags.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", envDuration("LIFT_SHUTDOWN_TIMEOUT", 30*time.Second), "how long requests in flight get to finish on shutdown, LIFT_SHUTDOWN_TIMEOUT")
+	flags.DurationVar(&config.Retention, "retention", envDuration("LIFT_RETENTION", DefaultRetention), "how long deleted workouts stay in the trash, LIFT_RETENTION")
+}
+
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return n
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return d
+	}
+	return fallback
+}
+
+// templates loads the templates the config asks for.
+func (config ServerConfig) templates() (*Templates, error) {
+	switch {
+	case config.Dev && config.TemplateDir == "":
+		return nil, errors.New("reloading the templates needs a directory to load them from")
+	case config.Dev:
+		return DevTemplates(config.TemplateDir)
+	case config.TemplateDir != "":
+		return LoadTemplates(os.DirFS(config.TemplateDir), false)
+	}
+	return LoadTemplates(TemplateFS(), false)
+}
+
+// static is the stylesheets the config asks for.
+func (config ServerConfig) static() fs.FS {
+	if config.StaticDir != "" {
+		return os.DirFS(config.StaticDir)
+	}
+	return StaticFS()
+}
+
+// Serve runs the web server until ctx is done, then shuts it down gracefully,
+// waiting up to the ShutdownTimeout for requests in flight. It fails before
+// listening if a template is missing or broken.
+func Serve(ctx context.Context, s ContextStorage, config ServerConfig) error {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return errors.New("the tls cert and key go together")
+	}
+	templates, err := config.templates()
+	if err != nil {
+		return err
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	metrics := NewMetrics()
+	s = metrics.Instrument(s)
+
+	done := make(chan struct{})
+	handlers := &Handlers{
+		Logger:    logger,
+		Metrics:   metrics,
+		Storage:   s,
+		Step:      config.PageSize,
+		Timeout:   config.RequestTimeout,
+		Retention: config.Retention,
+		Templates: templates,
+		Done:      done,
+	}
+
+	mux := http.NewServeMux()
+	static := http.FileServer(http.FS(config.static()))
+	mux.Handle("/stylesheets/", static)
+	// the service worker has to be at the top to look after every page.
+	mux.Handle("/pwa/", static)
+	mux.Handle("/sw.js", static)
+	mux.Handle("/manifest.webmanifest", static)
+	mux.HandleFunc("/", handlers.Handle)
+
+	server := &http.Server{
+		Addr:         config.Addr,
+		Handler:      mux,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+	}
+	server.RegisterOnShutdown(func() { close(done) })
+
+	go purgeTrash(ctx, s, handlers.retention(), logger)
+
+	errs := make(chan error, 1)
+	go func() {
+		if config.CertFile != "" && config.KeyFile != "" {
+			logger.Info("listening", "url", "https://"+config.Addr)
+			errs <- server.ListenAndServeTLS(config.CertFile, config.KeyFile)
+			return
+		}
+		logger.Info("listening", "url", "http://"+config.Addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down, finishing requests in flight")
+	shutdown, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdown); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// purgeTrash empties out what's been in the trash too long, now and every
+// hour until ctx is done.
+func purgeTrash(ctx context.Context, s ContextStorage, retention time.Duration, logger *slog.Logger) {
+	for {
+		purged, err := PurgeExpired(ctx, s, retention)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("purging the trash", "error", err)
+		} else if purged > 0 {
+			logger.Info("purged the trash", "repetitions", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package lifting
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestServerConfigFlags(t *testing.T) {
+	t.Setenv("LIFT_ADDR", ":8080")
+	t.Setenv("LIFT_PAGE_SIZE", "25")
+	t.Setenv("LIFT_READ_TIMEOUT", "not a duration")
+
+	var config ServerConfig
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	config.AddFlags(flags)
+	if err := flags.Parse([]string{"-page-size", "50", "-tls-cert", "cert.pem"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ServerConfig{
+		Addr:            ":8080",
+		PageSize:        50,
+		CertFile:        "cert.pem",
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		RequestTimeout:  10 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		Retention:       DefaultRetention,
+	}
+	if config != expected {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", expected), fmt.Sprintf("found %#v", config))
+	}
+
+	// a cert without its key is refused before anything's served.
+	if err := Serve(context.Background(), nil, config); err == nil {
+		t.Fatal("expected the cert to need a key")
+	}
+}
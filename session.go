@@ -0,0 +1,195 @@
+package lifting
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sessionRows is how many rows the session form starts with.
+const sessionRows = 3
+
+type (
+	// SessionRow is a row of the session form, an exercise with what's wrong
+	// with it, by field.
+	SessionRow struct {
+		Repetition
+		Errors map[string]string
+	}
+
+	// SessionContext is the context for logging a whole session at once. The
+	// date and category are the same for every row.
+	SessionContext struct {
+		*Context
+		SessionDate string
+		Category    string
+		Rows        []SessionRow
+		// Invalid is how many rows have something wrong with them.
+		Invalid int
+	}
+)
+
+// rowField splits a session form field like "Exercise.2" into the field and
+// the row it's in, ok false if it isn't a row's field.
+func rowField(key string) (field string, row int, ok bool) {
+	dot := strings.LastIndex(key, ".")
+	if dot < 0 {
+		return "", 0, false
+	}
+	row, err := strconv.Atoi(key[dot+1:])
+	if err != nil || row < 0 {
+		return "", 0, false
+	}
+	return key[:dot], row, true
+}
+
+// sessionForm splits the posted session form into a form for each row, in
+// order, each with the session's date and category. Rows left blank are
+// dropped unless keepBlank.
+func sessionForm(form url.Values, keepBlank bool) []url.Values {
+	byRow := make(map[int]url.Values)
+	for key, values := range form {
+		field, row, ok := rowField(key)
+		if !ok {
+			continue
+		}
+		if byRow[row] == nil {
+			byRow[row] = url.Values{}
+		}
+		byRow[row][field] = values
+	}
+	order := make([]int, 0, len(byRow))
+	for row := range byRow {
+		order = append(order, row)
+	}
+	sort.Ints(order)
+
+	rows := make([]url.Values, 0, len(order))
+	for _, row := range order {
+		values := byRow[row]
+		blank := true
+		for _, v := range values {
+			if len(v) > 0 && strings.TrimSpace(v[0]) != "" {
+				blank = false
+			}
+		}
+		if blank && !keepBlank {
+			continue
+		}
+		values.Set(sessionDate, form.Get(sessionDate))
+		values.Set(category, form.Get(category))
+		rows = append(rows, values)
+	}
+	return rows
+}
+
+// sessionContext is the session form, with rows for the repetitions.
+func (h *Handlers) sessionContext(r *http.Request, rows []SessionRow) (*SessionContext, error) {
+	context, err := h.getContext(r.Context(), Page{Count: h.Step})
+	if err != nil {
+		return nil, err
+	}
+	session := &SessionContext{
+		Context:     context,
+		SessionDate: context.Now,
+		Category:    r.FormValue(category),
+		Rows:        rows,
+	}
+	if date := r.FormValue(sessionDate); date != "" {
+		session.SessionDate = date
+	}
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			session.Invalid++
+		}
+		// the date and category are the session's, so their problems are too.
+		for _, field := range []string{sessionDate, category} {
+			if problem, ok := row.Errors[field]; ok {
+				if session.Errors == nil {
+					session.Errors = make(map[string]string)
+				}
+				session.Errors[field] = problem
+			}
+		}
+	}
+	return session, nil
+}
+
+// handleSession shows an empty session form.
+func (h *Handlers) handleSession(w http.ResponseWriter, r *http.Request) {
+	context, err := h.sessionContext(r, make([]SessionRow, sessionRows))
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	h.contextHandler(w, r, context, "session.html")
+}
+
+// handleSessionPost adds a row to the session form, duplicates one, or logs
+// every row in one go. Nothing is logged unless every row is valid.
+func (h *Handlers) handleSessionPost(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	_, adding := r.Form["add"]
+	duplicate := r.Form.Get("duplicate")
+	editing := adding || duplicate != ""
+
+	forms := sessionForm(r.Form, editing)
+	rows := make([]SessionRow, len(forms))
+	invalid := false
+	for i, form := range forms {
+		problems := h.formRepetition(r.Context(), form, &rows[i].Repetition)
+		if !editing && len(problems) > 0 {
+			rows[i].Errors = problems
+			invalid = true
+		}
+	}
+
+	switch {
+	case adding:
+		rows = append(rows, SessionRow{})
+	case duplicate != "":
+		n, err := strconv.Atoi(duplicate)
+		if err != nil || n < 0 || n >= len(rows) {
+			h.handleErrors(w, r, fmt.Errorf("duplicating row %q: %w", duplicate, ErrInvalidQuery), http.StatusBadRequest)
+			return
+		}
+		copied := SessionRow{Repetition: rows[n].Repetition}
+		rows = append(rows[:n+1], append([]SessionRow{copied}, rows[n+1:]...)...)
+	case len(rows) == 0:
+		h.handleErrors(w, r, fmt.Errorf("no exercises to log: %w", ErrInvalidRepetition), http.StatusBadRequest)
+		return
+	case !invalid:
+		reps := make([]Repetition, len(rows))
+		for i := range rows {
+			reps[i] = rows[i].Repetition
+		}
+		err := h.Storage.Load(r.Context(), reps)
+		var problem *InvalidRepetitionError
+		if !errors.As(err, &problem) {
+			if err != nil {
+				h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+				return
+			}
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		if problem.Index >= 0 && problem.Index < len(rows) {
+			rows[problem.Index].Errors = problem.Fields
+		}
+		invalid = true
+	}
+
+	context, err := h.sessionContext(r, rows)
+	if err != nil {
+		h.handleErrors(w, r, err, statusFor(err, http.StatusInternalServerError))
+		return
+	}
+	if invalid {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	h.contextHandler(w, r, context, "session.html")
+}
@@ -0,0 +1,48 @@
+package lifting
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestSessionForm(t *testing.T) {
+	form := url.Values{
+		"SessionDate": {"2018-12-20"},
+		"Category":    {"strength"},
+		"Exercise.0":  {"squat"},
+		"Weight.0":    {"225"},
+		"Effort.0":    {"101"},
+		"Exercise.10": {"deadlift"},
+		"Exercise.2":  {""},
+		"Weight.2":    {""},
+		"add":         {"row"},
+	}
+
+	rows := sessionForm(form, false)
+	if len(rows) != 2 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 2), fmt.Sprintf("found %#v", len(rows)))
+	}
+	if rows[0].Get("Exercise") != "squat" || rows[1].Get("Exercise") != "deadlift" {
+		t.Fatal("expected the rows in order", rows)
+	}
+	for _, row := range rows {
+		if row.Get("SessionDate") != "2018-12-20" || row.Get("Category") != "strength" {
+			t.Fatal("expected the session's date and category on every row", row)
+		}
+	}
+
+	if rows = sessionForm(form, true); len(rows) != 3 || rows[1].Get("Exercise") != "" {
+		t.Fatal("expected to keep the blank row", rows)
+	}
+
+	var rep Repetition
+	rows = sessionForm(form, false)
+	if problems := (&Handlers{}).formRepetition(context.Background(), rows[0], &rep); len(problems) != 1 || problems["Effort"] == "" {
+		t.Fatal("expected the row's effort to be out of range", problems)
+	}
+	if rep.Exercise != "squat" || rep.Weight != 225 || rep.Category != "strength" {
+		t.Fatal("mimsatch", fmt.Sprintf("found %#v", rep))
+	}
+}
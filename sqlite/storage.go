@@ -1,12 +1,17 @@
 package sqlite
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/civil"
 	"github.com/jmoiron/sqlx"
 	"github.com/awinterman/lifting"
-	_ "github.com/mattn/go-sqlite3" // how they told me to do it i guess
+	"github.com/mattn/go-sqlite3"
 )
 
 const (
@@ -26,17 +31,105 @@ const (
             );
         `
 
+	trackSchema = `
+            CREATE TABLE IF NOT EXISTS track (
+               workout_id integer primary key,
+               format varchar NOT NULL,
+               data blob NOT NULL
+            );
+        `
+
+	measurementSchema = `
+            CREATE TABLE IF NOT EXISTS measurement (
+               id integer primary key,
+               kind varchar NOT NULL,
+               site varchar,
+               value decimal NOT NULL,
+               units varchar,
+               measured_on date NOT NULL,
+               comment text
+            );
+        `
+
+	// changeSchema logs every change to a workout, with JSON snapshots of it
+	// before and after.
+	changeSchema = `
+            CREATE TABLE IF NOT EXISTS workout_change (
+               id integer primary key,
+               workout_id integer NOT NULL,
+               action varchar NOT NULL,
+               actor varchar,
+               changed_at timestamp NOT NULL,
+               before_version text,
+               after_version text
+            );
+        `
+
+	// ftsSchema indexes the comments for search when sqlite was built with
+	// FTS5, i.e. with the sqlite_fts5 tag. The triggers keep it in sync.
+	ftsSchema = `
+            CREATE VIRTUAL TABLE IF NOT EXISTS workout_fts
+               USING fts5(comment, content='workout', content_rowid='id');
+            CREATE TRIGGER IF NOT EXISTS workout_fts_insert AFTER INSERT ON workout BEGIN
+               INSERT INTO workout_fts(rowid, comment) VALUES (new.id, new.comment);
+            END;
+            CREATE TRIGGER IF NOT EXISTS workout_fts_delete AFTER DELETE ON workout BEGIN
+               INSERT INTO workout_fts(workout_fts, rowid, comment) VALUES ('delete', old.id, old.comment);
+            END;
+            CREATE TRIGGER IF NOT EXISTS workout_fts_update AFTER UPDATE ON workout BEGIN
+               INSERT INTO workout_fts(workout_fts, rowid, comment) VALUES ('delete', old.id, old.comment);
+               INSERT INTO workout_fts(rowid, comment) VALUES (new.id, new.comment);
+            END;
+        `
+	hasFTS     = `SELECT count(*) FROM sqlite_master WHERE name = 'workout_fts'`
+	rebuildFTS = `INSERT INTO workout_fts(workout_fts) VALUES ('rebuild')`
+
+	// hasColumn and addColumn migrate databases made before a column was
+	// added to the workout table.
+	hasColumn = `SELECT count(*) FROM pragma_table_info('workout') WHERE name = ?`
+	addColumn = `ALTER TABLE workout ADD COLUMN %s %s`
+	// clientIndex keeps a client from storing the same workout twice.
+	clientIndex = `CREATE UNIQUE INDEX IF NOT EXISTS workout_client_id ON workout(client_id)`
+	// backfillStamps stamps the rows stored before there were stamps from
+	// the change log, or their session date if they were never changed.
+	backfillStamps = `UPDATE workout SET
+               created_at = COALESCE(created_at, (SELECT min(changed_at) FROM workout_change c WHERE c.workout_id = workout.id), session_date),
+               updated_at = COALESCE(updated_at, (SELECT max(changed_at) FROM workout_change c WHERE c.workout_id = workout.id), created_at, session_date),
+               seq = COALESCE(seq, (SELECT max(id) FROM workout_change c WHERE c.workout_id = workout.id), 0)
+            WHERE created_at IS NULL OR updated_at IS NULL OR seq IS NULL`
+
 	drop = `
+            DROP TABLE IF EXISTS workout_fts;
+            DROP TABLE IF EXISTS workout_change;
+            DROP TABLE IF EXISTS measurement;
+            DROP TABLE IF EXISTS track;
             DROP TABLE IF EXISTS workout;
         `
+	// units are NOT NULL here, so having none is stored as empty.
 	namedInsert = `INSERT INTO workout(
-            exercise, effort, volume, weight, duration, session_date, units, failure, category, comment
+            exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, client_id, rest
             ) values (
-            :exercise, :effort, :volume, :weight, :duration, :session_date, :units, :failure, :category, :comment
+            :exercise, :effort, :volume, :weight, :duration, :session_date, COALESCE(:units, ''), :failure, :category, :comment, :client_id, :rest
 			)`
 
-	//
-	namedDelete = `DELETE FROM workout WHERE id = :id`
+	// deleting moves a row to the trash by stamping deleted_at, purging
+	// removes it for good.
+	trash    = `UPDATE workout SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+	restore  = `UPDATE workout SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`
+	getTrash = `
+            SELECT
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, created_at, updated_at, seq, client_id, rest, deleted_at
+            FROM workout WHERE deleted_at IS NOT NULL
+            ORDER BY deleted_at DESC, id DESC`
+	countTrash = `SELECT COUNT(*) FROM workout WHERE deleted_at IS NOT NULL`
+	// restoreStamps puts back when a restored workout was created, updated
+	// and deleted.
+	restoreStamps = `UPDATE workout
+			SET created_at = COALESCE(?, created_at), updated_at = COALESCE(?, updated_at), deleted_at = ?
+			WHERE id = ?`
+	purgeTracks = `DELETE FROM track WHERE workout_id IN (SELECT id FROM workout WHERE deleted_at <= ?)`
+	purge       = `DELETE FROM workout WHERE deleted_at <= ?`
+
 	namedUpdate = `UPDATE workout
 			SET exercise = :exercise,
 				effort = :effort,
@@ -44,33 +137,86 @@ const (
 				 weight = :weight, 
 				 duration = :duration, 
 				 session_date = :session_date, 
-				 units = :units, 
+				 units = COALESCE(:units, ''), 
 				 failure = :failure, 
 				 category = :category,
-				 comment = :comment
+				 comment = :comment,
+				 rest = :rest
 			WHERE
-				id = :id
+				id = :id AND deleted_at IS NULL
 
             `
 
-	uniquecategory = `SELECT DISTINCT category FROM workout`
-	uniqueExercise = `SELECT DISTINCT exercise FROM workout`
-	uniqueUnits    = `SELECT DISTINCT units FROM workout WHERE units != ""`
+	namedInsertChange = `INSERT INTO workout_change(
+            workout_id, action, actor, changed_at, before_version, after_version
+        ) values (
+            :workout_id, :action, :actor, :changed_at, :before_version, :after_version
+        )`
+	// stamp marks a workout with its latest change.
+	stamp = `UPDATE workout
+			SET seq = ?, updated_at = ?, created_at = COALESCE(created_at, ?)
+			WHERE id = ?`
+	changesSince = `
+            SELECT id, workout_id, action, actor, changed_at, before_version, after_version
+            FROM workout_change WHERE id > ?
+            ORDER BY id LIMIT ?`
+	getChanges = `
+            SELECT id, workout_id, action, actor, changed_at, before_version, after_version
+            FROM workout_change WHERE workout_id = ?
+            ORDER BY id`
+
+	namedInsertTrack = `INSERT OR REPLACE INTO track(workout_id, format, data)
+			values (:workout_id, :format, :data)`
+	getTrack = `SELECT workout_id, format, data FROM track WHERE workout_id = ?`
+
+	namedInsertMeasurement = `INSERT INTO measurement(
+            kind, site, value, units, measured_on, comment
+        ) values (
+            :kind, :site, :value, :units, :measured_on, :comment
+        )`
+	namedUpdateMeasurement = `UPDATE measurement
+			SET kind = :kind,
+				site = :site,
+				value = :value,
+				units = :units,
+				measured_on = :measured_on,
+				comment = :comment
+			WHERE
+				id = :id`
+	namedDeleteMeasurement = `DELETE FROM measurement WHERE id = :id`
+	getMeasurements        = `
+            SELECT id, kind, site, value, units, measured_on, comment
+            FROM measurement
+            WHERE (:kind = '' OR kind = :kind) AND measured_on BETWEEN :start AND :end
+            ORDER BY measured_on, id`
+
+	uniquecategory = `SELECT DISTINCT category FROM workout WHERE deleted_at IS NULL`
+	uniqueExercise = `SELECT DISTINCT exercise FROM workout WHERE deleted_at IS NULL`
+	uniqueUnits    = `SELECT DISTINCT units FROM workout WHERE units != "" AND deleted_at IS NULL`
 
-	getlast = `
-            SELECT 
-            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment
-            FROM workout 
-            ORDER BY session_date desc, id desc LIMIT ? OFFSET ?`
 	getBetween = `
             SELECT 
-            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment
-            FROM workout WHERE session_date BETWEEN ? and ? 
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, created_at, updated_at, seq, client_id, rest
+            FROM workout WHERE session_date BETWEEN ? and ? AND deleted_at IS NULL
             ORDER BY session_date DESC, id DESC`
+	countBetween = `SELECT COUNT(*) FROM workout WHERE session_date BETWEEN ? and ? AND deleted_at IS NULL`
+
+	search = `
+            SELECT
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, created_at, updated_at, seq, client_id, rest
+            FROM workout %s %s LIMIT :count`
+	exists     = `SELECT EXISTS (SELECT 1 FROM workout %s)`
+	ftsSearch  = `id IN (SELECT rowid FROM workout_fts WHERE workout_fts MATCH :text)`
+	likeSearch = `comment LIKE '%' || :text || '%'`
+
 	getByID = `
             SELECT 
-            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment
-            FROM workout WHERE id = ?`
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, created_at, updated_at, seq, client_id, rest
+            FROM workout WHERE id = ? AND deleted_at IS NULL`
+	getByClientID = `
+            SELECT
+            id, exercise, effort, volume, weight, duration, session_date, units, failure, category, comment, created_at, updated_at, seq, client_id, rest
+            FROM workout WHERE client_id = ?`
 	getByCategory = `
 			WITH vars AS (SELECT :category as category)
             SELECT 
@@ -86,6 +232,7 @@ const (
 				false as failure,
 				workout.category as category
 			FROM workout INNER JOIN vars ON(workout.category LIKE '%'||vars.category||'%')
+			WHERE workout.deleted_at IS NULL
 			GROUP BY exercise, workout.category, units
 			ORDER BY 
 				workout.category = vars.category, workout.category like vars.category||'%', workout.category like '%'||vars.category||'%',
@@ -94,10 +241,27 @@ const (
 			LIMIT :count OFFSET :offset`
 )
 
+// timestampFormat is how times are stored, in UTC so they sort as text.
+const timestampFormat = "2006-01-02 15:04:05"
+
+// columns were added to the workout table after it was first made, they're
+// added to older databases when they're opened.
+var columns = []struct{ name, definition string }{
+	{"deleted_at", "timestamp"},
+	{"created_at", "timestamp"},
+	{"updated_at", "timestamp"},
+	{"seq", "integer"},
+	{"client_id", "text"},
+	{"rest", "integer"},
+}
+
 // SqliteStorage is a sqlite implementation of the Storage interface
 type SqliteStorage struct {
 	Path string
 	db   *sqlx.DB
+	// fts is true if comments can be searched with FTS5, otherwise we fall
+	// back to LIKE.
+	fts bool
 }
 
 // CreateStorage sets up the database resources
@@ -106,96 +270,355 @@ func CreateStorage(Path string, db *sqlx.DB) (*SqliteStorage, error) {
 
 	if s.db == nil {
 		db, err := sqlx.Connect("sqlite3", s.Path)
-		s.db = db
-		s.db.Ping()
 		if err != nil {
 			return nil, err
 		}
-		stmt, err := s.db.Prepare(workoutSchema)
-		if err != nil {
-			return nil, err
+		s.db = db
+		for _, schema := range []string{workoutSchema, trackSchema, measurementSchema, changeSchema} {
+			stmt, err := s.db.Prepare(schema)
+			if err != nil {
+				return nil, err
+			}
+			_, err = stmt.Exec()
+			if err != nil {
+				return nil, err
+			}
+			if err = stmt.Close(); err != nil {
+				return nil, err
+			}
 		}
-		_, err = stmt.Exec()
-		if err != nil {
+		if err = s.migrate(); err != nil {
 			return nil, err
 		}
-		return &s, stmt.Close()
+		s.fts = s.createFTS()
+		return &s, nil
 	}
 	return &s, nil
 }
 
+// migrate adds any columns the workout table is missing, and stamps the rows
+// from before they were added.
+func (s *SqliteStorage) migrate() error {
+	for _, column := range columns {
+		var existing int
+		if err := s.db.Get(&existing, hasColumn, column.name); err != nil {
+			return err
+		}
+		if existing > 0 {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf(addColumn, column.name, column.definition)); err != nil {
+			return err
+		}
+	}
+	if _, err := s.db.Exec(clientIndex); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(backfillStamps)
+	return err
+}
+
+// createFTS sets up the full text index of comments, indexing any existing
+// rows the first time. It's false if this sqlite doesn't have FTS5.
+func (s *SqliteStorage) createFTS() bool {
+	var existing int
+	if err := s.db.Get(&existing, hasFTS); err != nil {
+		return false
+	}
+	if _, err := s.db.Exec(ftsSchema); err != nil {
+		return false
+	}
+	if existing == 0 {
+		if _, err := s.db.Exec(rebuildFTS); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 // Drop drops the database
 func (s *SqliteStorage) Drop() error {
 	_, err := s.db.Exec(drop)
 	return err
 }
 
+// Ping checks the database can be reached.
+func (s *SqliteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 //Load the repetitions into the database
-func (s *SqliteStorage) Load(repetitions []lifting.Repetition) error {
-	tx, err := s.db.Beginx()
+func (s *SqliteStorage) Load(ctx context.Context, repetitions []lifting.Repetition) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	for _, rep := range repetitions {
+	for i, rep := range repetitions {
 		workout, err := lifting.RepetitionToWorkout(rep)
 		if err != nil {
 			tx.Rollback()
-			return err
+			return lifting.InvalidAt(err, i)
 		}
 
 		if workout.ID == nil {
-			_, err = tx.NamedExec(
-				namedInsert,
-				&workout,
-			)
+			repetitions[i].ID, err = insert(ctx, tx, &workout)
+			if err == nil {
+				err = recordChange(ctx, tx, *repetitions[i].ID, lifting.Inserted, nil, &repetitions[i])
+			}
 		} else {
-			_, err = tx.NamedExec(
-				namedUpdate,
-				&workout,
-			)
-
+			var before *lifting.Repetition
+			before, err = getInTx(ctx, tx, *workout.ID)
+			if err == nil {
+				_, err = tx.NamedExecContext(
+					ctx,
+					namedUpdate,
+					&workout,
+				)
+			}
+			if err == nil {
+				repetitions[i].CreatedAt = before.CreatedAt
+				err = recordChange(ctx, tx, *workout.ID, lifting.Updated, before, &repetitions[i])
+			}
 		}
 		if err != nil {
 			tx.Rollback()
-			return err
+			return translate(err)
 		}
 	}
 	return tx.Commit()
 }
 
-// Delete removes the corresponding database row
-func (s *SqliteStorage) Delete(id int) error {
-	tx, err := s.db.Beginx()
+// insert adds a workout as part of a transaction, returning the ID it was
+// given.
+func insert(ctx context.Context, tx *sqlx.Tx, workout *lifting.WorkoutRow) (*int, error) {
+	result, err := tx.NamedExecContext(ctx, namedInsert, workout)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	inserted := int(id)
+	return &inserted, nil
+}
+
+// getInTx finds a repetition that isn't in the trash as part of a
+// transaction, ErrNotFound if there isn't one.
+func getInTx(ctx context.Context, tx *sqlx.Tx, id int) (*lifting.Repetition, error) {
+	ws := []lifting.WorkoutRow{}
+	if err := tx.SelectContext(ctx, &ws, getByID, id); err != nil {
+		return nil, err
+	}
+	if len(ws) == 0 {
+		return nil, fmt.Errorf("repetition %d: %w", id, lifting.ErrNotFound)
+	}
+	rep, err := lifting.WorkoutToRepetition(ws[0])
+	if err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// recordChange adds a change to the log as part of the transaction making it,
+// and stamps the workout with it. If after is set, it's stamped too.
+func recordChange(ctx context.Context, tx *sqlx.Tx, id int, action lifting.Action, before, after *lifting.Repetition) error {
+	row, err := lifting.NewChangeRow(ctx, id, action, before, after)
 	if err != nil {
 		return err
 	}
+	result, err := tx.NamedExecContext(ctx, namedInsertChange, &row)
+	if err != nil {
+		return err
+	}
+	seq, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, stamp, seq, row.At, row.At, id); err != nil {
+		return err
+	}
+	lifting.Stamp(after, int(seq), row.At)
+	return nil
+}
 
-	workout := lifting.WorkoutRow{ID: &id}
+// Delete moves the repetition to the trash.
+func (s *SqliteStorage) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
 
-	_, err = tx.NamedExec(
-		namedDelete,
-		workout,
-	)
+	before, err := getInTx(ctx, tx, id)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, trash, time.Now().UTC().Format(timestampFormat), id)
+	}
+	if err == nil {
+		err = recordChange(ctx, tx, id, lifting.Deleted, before, nil)
+	}
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	return tx.Commit()
+}
+
+// Restore takes a repetition back out of the trash.
+func (s *SqliteStorage) Restore(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, restore, id)
+	if err == nil {
+		err = mustAffect(result, "deleted repetition", id)
+	}
+	var after *lifting.Repetition
+	if err == nil {
+		after, err = getInTx(ctx, tx, id)
+	}
+	if err == nil {
+		err = recordChange(ctx, tx, id, lifting.Restored, nil, after)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetChanges lists the changes made to a repetition, oldest first.
+func (s *SqliteStorage) GetChanges(ctx context.Context, id int) ([]lifting.Change, error) {
+	rows := []lifting.ChangeRow{}
+	if err := s.db.SelectContext(ctx, &rows, getChanges, id); err != nil {
+		return nil, err
+	}
+	return lifting.RowsToChanges(rows)
+}
+
+// trashedRow is a workout row along with when it was deleted, which the
+// driver parses since the column is a timestamp.
+type trashedRow struct {
+	lifting.WorkoutRow
+	DeletedAt time.Time `db:"deleted_at"`
+}
+
+// GetTrash lists the repetitions in the trash, most recently deleted first.
+func (s *SqliteStorage) GetTrash(ctx context.Context) ([]lifting.Trashed, error) {
+	rows := []trashedRow{}
+	if err := s.db.SelectContext(ctx, &rows, getTrash); err != nil {
+		return nil, err
+	}
+
+	trashed := make([]lifting.Trashed, len(rows))
+	for i, row := range rows {
+		rep, err := lifting.WorkoutToRepetition(row.WorkoutRow)
+		if err != nil {
+			return nil, err
+		}
+		trashed[i] = lifting.Trashed{Repetition: rep, DeletedAt: row.DeletedAt}
+	}
+	return trashed, nil
+}
+
+// CountTrash counts the repetitions in the trash.
+func (s *SqliteStorage) CountTrash(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.GetContext(ctx, &count, countTrash)
+	return count, err
+}
+
+// Purge permanently removes the repetitions, and their tracks, that were put
+// in the trash by a time.
+func (s *SqliteStorage) Purge(ctx context.Context, before time.Time) (int, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := before.UTC().Format(timestampFormat)
+	if _, err = tx.ExecContext(ctx, purgeTracks, cutoff); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, purge, cutoff)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// AttachTrack stores the original track file for a repetition, replacing any
+// that was already attached.
+func (s *SqliteStorage) AttachTrack(ctx context.Context, track lifting.Track) error {
+	_, err := s.db.NamedExecContext(ctx, namedInsertTrack, &track)
+	return translate(err)
+}
+
+// LoadWithTrack inserts a repetition and attaches its track in one
+// transaction, so there's never one without the other.
+func (s *SqliteStorage) LoadWithTrack(ctx context.Context, repetition *lifting.Repetition, track lifting.Track) error {
+	workout, err := lifting.RepetitionToWorkout(*repetition)
+	if err != nil {
+		return err
+	}
+	workout.ID = nil
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
 
+	id, err := insert(ctx, tx, &workout)
+	if err == nil {
+		repetition.ID = id
+		err = recordChange(ctx, tx, *id, lifting.Inserted, nil, repetition)
+	}
+	if err == nil {
+		track.RepetitionID = *id
+		_, err = tx.NamedExecContext(ctx, namedInsertTrack, &track)
+	}
+	if err != nil {
+		tx.Rollback()
+		repetition.ID = nil
+		return translate(err)
+	}
 	return tx.Commit()
 }
 
-func (s *SqliteStorage) getCollectionWithStruct(query string, arg interface{}) ([]lifting.Repetition, error) {
+// GetTrack retrieves the track attached to a repetition, ErrNotFound if there
+// is none.
+func (s *SqliteStorage) GetTrack(ctx context.Context, id int) (*lifting.Track, error) {
+	tracks := []lifting.Track{}
+	err := s.db.SelectContext(ctx, &tracks, getTrack, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("track for repetition %d: %w", id, lifting.ErrNotFound)
+	}
+	return &tracks[0], nil
+}
+
+func (s *SqliteStorage) getCollectionWithStruct(ctx context.Context, query string, arg interface{}) ([]lifting.Repetition, error) {
 	var (
 		rs []lifting.Repetition
 		w  lifting.WorkoutRow
 		r  lifting.Repetition
 	)
 
-	rows, err := s.db.NamedQuery(query, arg)
+	rows, err := s.db.NamedQueryContext(ctx, query, arg)
 	if err != nil {
-		panic(err)
+		return rs, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		err = rows.StructScan(&w)
@@ -209,15 +632,15 @@ func (s *SqliteStorage) getCollectionWithStruct(query string, arg interface{}) (
 		}
 
 	}
-	return rs, nil
+	return rs, rows.Err()
 }
 
-func (s *SqliteStorage) getCollection(query string, args ...interface{}) ([]lifting.Repetition, error) {
+func (s *SqliteStorage) getCollection(ctx context.Context, query string, args ...interface{}) ([]lifting.Repetition, error) {
 	var rs []lifting.Repetition
 	ws := []lifting.WorkoutRow{}
-	err := s.db.Select(&ws, query, args...)
+	err := s.db.SelectContext(ctx, &ws, query, args...)
 	if err != nil {
-		panic(err)
+		return rs, err
 	}
 	rs = make([]lifting.Repetition, len(ws))
 	for i, w := range ws {
@@ -230,9 +653,9 @@ func (s *SqliteStorage) getCollection(query string, args ...interface{}) ([]lift
 }
 
 //GetUniqueCategories retrieves what categories have been input
-func (s *SqliteStorage) GetUniqueCategories() ([]string, error) {
+func (s *SqliteStorage) GetUniqueCategories(ctx context.Context) ([]string, error) {
 	categorys := make([]string, 0)
-	err := s.db.Select(&categorys, uniquecategory)
+	err := s.db.SelectContext(ctx, &categorys, uniquecategory)
 	if err != nil {
 		return categorys, err
 	}
@@ -240,9 +663,9 @@ func (s *SqliteStorage) GetUniqueCategories() ([]string, error) {
 }
 
 //GetUniqueUnits retrieves what categories have been input
-func (s *SqliteStorage) GetUniqueUnits() ([]string, error) {
+func (s *SqliteStorage) GetUniqueUnits(ctx context.Context) ([]string, error) {
 	categorys := make([]string, 0)
-	err := s.db.Select(&categorys, uniqueUnits)
+	err := s.db.SelectContext(ctx, &categorys, uniqueUnits)
 	if err != nil {
 		return categorys, err
 	}
@@ -250,9 +673,9 @@ func (s *SqliteStorage) GetUniqueUnits() ([]string, error) {
 }
 
 //GetUniqueExercises retrieves what Exercises have been input
-func (s *SqliteStorage) GetUniqueExercises() ([]string, error) {
+func (s *SqliteStorage) GetUniqueExercises(ctx context.Context) ([]string, error) {
 	r := make([]string, 0)
-	err := s.db.Select(&r, uniqueExercise)
+	err := s.db.SelectContext(ctx, &r, uniqueExercise)
 	if err != nil {
 		return r, err
 	}
@@ -260,27 +683,81 @@ func (s *SqliteStorage) GetUniqueExercises() ([]string, error) {
 }
 
 //GetByCategory retrieves reps in a given category
-func (s *SqliteStorage) GetByCategory(category string, count, offset int) ([]lifting.Repetition, error) {
-	return s.getCollectionWithStruct(getByCategory, lifting.CategoryQuery{
+func (s *SqliteStorage) GetByCategory(ctx context.Context, category string, count, offset int) ([]lifting.Repetition, error) {
+	return s.getCollectionWithStruct(ctx, getByCategory, lifting.CategoryQuery{
 		Category: category, Count: count, Offset: offset,
 	})
 }
 
-// GetLast retrieves data in order
-func (s *SqliteStorage) GetLast(count, offset int) ([]lifting.Repetition, error) {
-	return s.getCollection(getlast, count, offset)
+// GetLast retrieves a page of the most recent repetitions, newest first,
+// starting from a cursor returned in a previous page, or the newest if empty.
+func (s *SqliteStorage) GetLast(ctx context.Context, count int, cursor string) (lifting.Result, error) {
+	return s.Search(ctx, lifting.Query{Count: count, Cursor: cursor})
+}
+
+// Search finds the repetitions matching the query, a page at a time.
+func (s *SqliteStorage) Search(ctx context.Context, q lifting.Query) (lifting.Result, error) {
+	textSearch := likeSearch
+	if s.fts {
+		textSearch = ftsSearch
+		q.Text = ftsPhrases(q.Text)
+	}
+
+	statement, err := q.SQL(textSearch)
+	if err != nil {
+		return lifting.Result{}, err
+	}
+	// one extra tells us whether there's another page.
+	statement.Args["count"] = q.PageSize() + 1
+
+	reps, err := s.getCollectionWithStruct(ctx, fmt.Sprintf(search, statement.Where, statement.Order), statement.Args)
+	if err != nil {
+		return lifting.Result{}, err
+	}
+
+	behind := false
+	if statement.Behind != "" {
+		behind, err = s.exists(ctx, fmt.Sprintf(exists, statement.Behind), statement.Args)
+		if err != nil {
+			return lifting.Result{}, err
+		}
+	}
+	return lifting.NewResult(q, reps, behind)
+}
+
+// exists is true if the query finds anything.
+func (s *SqliteStorage) exists(ctx context.Context, query string, arg interface{}) (bool, error) {
+	stmt, err := s.db.PrepareNamedContext(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var found bool
+	err = stmt.GetContext(ctx, &found, arg)
+	return found, err
+}
+
+// ftsPhrases quotes each word of the search so punctuation in it isn't taken
+// for FTS5 query syntax; the words must all appear.
+func ftsPhrases(text string) string {
+	words := strings.Fields(text)
+	for i, w := range words {
+		words[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
 }
 
 // GetByID finds a particular repetition
-func (s *SqliteStorage) GetByID(id int) (*lifting.Repetition, error) {
-	reps, err := s.getCollection(getByID, id)
+func (s *SqliteStorage) GetByID(ctx context.Context, id int) (*lifting.Repetition, error) {
+	reps, err := s.getCollection(ctx, getByID, id)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if len(reps) == 0 {
-		return nil, nil
+		return nil, fmt.Errorf("repetition %d: %w", id, lifting.ErrNotFound)
 	}
 
 	if len(reps) > 1 {
@@ -290,13 +767,221 @@ func (s *SqliteStorage) GetByID(id int) (*lifting.Repetition, error) {
 	return &reps[0], nil
 }
 
+// GetByClientID returns the rep stored with the client ID, even from the trash.
+func (s *SqliteStorage) GetByClientID(ctx context.Context, clientID string) (*lifting.Repetition, error) {
+	reps, err := s.getCollection(ctx, getByClientID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if len(reps) == 0 {
+		return nil, fmt.Errorf("repetition with client ID %q: %w", clientID, lifting.ErrNotFound)
+	}
+	return &reps[0], nil
+}
+
 // GetBetween returns the reps between the start and end date.
-func (s *SqliteStorage) GetBetween(start, end civil.Date) ([]lifting.Repetition, error) {
-	return s.getCollection(getBetween, start, end)
+func (s *SqliteStorage) GetBetween(ctx context.Context, start, end civil.Date) ([]lifting.Repetition, error) {
+	return s.getCollection(ctx, getBetween, start.String(), end.String())
+}
+
+// CountBetween counts the reps between the start and end date.
+func (s *SqliteStorage) CountBetween(ctx context.Context, start, end civil.Date) (int, error) {
+	var count int
+	err := s.db.GetContext(ctx, &count, countBetween, start.String(), end.String())
+	return count, err
 }
 
-func checkErr(err error) {
+// LoadMeasurements inserts or updates the measurements, setting the ID of any
+// that were newly inserted.
+func (s *SqliteStorage) LoadMeasurements(ctx context.Context, measurements []lifting.Measurement) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	if err = loadMeasurements(ctx, tx, measurements); err != nil {
+		tx.Rollback()
+		return translate(err)
+	}
+	return tx.Commit()
+}
+
+// loadMeasurements is LoadMeasurements as part of a transaction.
+func loadMeasurements(ctx context.Context, tx *sqlx.Tx, measurements []lifting.Measurement) error {
+	for i, m := range measurements {
+		row, err := lifting.MeasurementToRow(m)
+		if err != nil {
+			return err
+		}
+
+		var result sql.Result
+		if row.ID == nil {
+			result, err = tx.NamedExecContext(ctx, namedInsertMeasurement, &row)
+			if err == nil {
+				var id int64
+				id, err = result.LastInsertId()
+				inserted := int(id)
+				measurements[i].ID = &inserted
+			}
+		} else {
+			result, err = tx.NamedExecContext(ctx, namedUpdateMeasurement, &row)
+			if err == nil {
+				err = mustAffect(result, "measurement", *row.ID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMeasurements retrieves the measurements of a kind taken between the start
+// and end dates, oldest first. An empty kind retrieves every kind.
+func (s *SqliteStorage) GetMeasurements(ctx context.Context, kind string, start, end civil.Date) ([]lifting.Measurement, error) {
+	ms := make([]lifting.Measurement, 0)
+
+	rows, err := s.db.NamedQueryContext(ctx, getMeasurements, lifting.MeasurementQuery{
+		Kind: kind, Start: start.String(), End: end.String(),
+	})
+	if err != nil {
+		return ms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row lifting.MeasurementRow
+		err = rows.StructScan(&row)
+		if err != nil {
+			return ms, err
+		}
+		m, err := lifting.RowToMeasurement(row)
+		if err != nil {
+			return ms, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, rows.Err()
+}
+
+// DeleteMeasurement removes the corresponding measurement
+func (s *SqliteStorage) DeleteMeasurement(ctx context.Context, id int) error {
+	result, err := s.db.NamedExecContext(ctx, namedDeleteMeasurement, lifting.MeasurementRow{ID: &id})
+	if err != nil {
+		return err
+	}
+	return mustAffect(result, "measurement", id)
+}
+
+// mustAffect turns an update or delete that didn't touch a row into
+// lifting.ErrNotFound.
+func mustAffect(result sql.Result, what string, id int) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %d: %w", what, id, lifting.ErrNotFound)
+	}
+	return nil
+}
+
+// translate turns violations of unique and foreign key constraints into
+// lifting.ErrConflict.
+func translate(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey, sqlite3.ErrConstraintForeignKey:
+			return fmt.Errorf("%w: %v", lifting.ErrConflict, err)
+		}
+	}
+	return err
+}
+
+// ChangesSince lists the changes after the one with the sequence number seq,
+// oldest first, at most lifting.ChangeFeedPage of them. sqlite has one writer
+// at a time, so the changes are committed in order and none will turn up
+// later behind the last one listed.
+func (s *SqliteStorage) ChangesSince(ctx context.Context, seq int) ([]lifting.Change, error) {
+	rows := []lifting.ChangeRow{}
+	if err := s.db.SelectContext(ctx, &rows, changesSince, seq, lifting.ChangeFeedPage); err != nil {
+		return nil, err
+	}
+	return lifting.RowsToChanges(rows)
+}
+
+// LoadBackup loads a backup into the empty database in one transaction, so
+// either all of it is restored or none of it is. The repetitions get new IDs
+// but keep when they were created, updated and deleted, and the change log
+// starts again with them being inserted.
+func (s *SqliteStorage) LoadBackup(ctx context.Context, backup lifting.Backup) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = loadBackup(ctx, tx, backup); err != nil {
+		tx.Rollback()
+		return translate(err)
+	}
+	return tx.Commit()
+}
+
+func loadBackup(ctx context.Context, tx *sqlx.Tx, backup lifting.Backup) error {
+	var used bool
+	if err := tx.GetContext(ctx, &used, fmt.Sprintf(exists, "")); err != nil {
+		return err
+	}
+	if used {
+		return fmt.Errorf("%w: can only restore a backup into an empty log", lifting.ErrConflict)
+	}
+
+	// the backed up IDs map to the ones the repetitions get now.
+	ids := make(map[int]int, len(backup.Repetitions))
+	for i, r := range backup.Repetitions {
+		rep := r.Repetition
+		rep.ID = nil
+		workout, err := lifting.RepetitionToWorkout(rep)
+		if err != nil {
+			return lifting.InvalidAt(err, i)
+		}
+		if rep.ID, err = insert(ctx, tx, &workout); err != nil {
+			return err
+		}
+		if err = recordChange(ctx, tx, *rep.ID, lifting.Inserted, nil, &rep); err != nil {
+			return err
+		}
+
+		var deleted interface{}
+		if r.DeletedAt != nil {
+			deleted = r.DeletedAt.UTC().Format(timestampFormat)
+		}
+		created := sql.NullTime{Time: r.CreatedAt, Valid: !r.CreatedAt.IsZero()}
+		updated := sql.NullTime{Time: r.UpdatedAt, Valid: !r.UpdatedAt.IsZero()}
+		if _, err = tx.ExecContext(ctx, restoreStamps, created, updated, deleted, *rep.ID); err != nil {
+			return err
+		}
+		if r.ID != nil {
+			ids[*r.ID] = *rep.ID
+		}
+	}
+
+	for _, t := range backup.Tracks {
+		id, ok := ids[t.RepetitionID]
+		if !ok {
+			return fmt.Errorf("%w: track for repetition %d, which isn't in the backup", lifting.ErrInvalidBackup, t.RepetitionID)
+		}
+		t.RepetitionID = id
+		if _, err := tx.NamedExecContext(ctx, namedInsertTrack, &t); err != nil {
+			return err
+		}
+	}
+
+	measurements := make([]lifting.Measurement, len(backup.Measurements))
+	for i, m := range backup.Measurements {
+		m.ID = nil
+		measurements[i] = m
 	}
+	return loadMeasurements(ctx, tx, measurements)
 }
@@ -1,16 +1,22 @@
 package sqlite
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/awinterman/lifting"
 	"cloud.google.com/go/civil"
+	"github.com/mattn/go-sqlite3"
 )
 
 func TestSqlite(t *testing.T) {
-	storage, err := CreateStorage("test.sqlite", nil)
-	defer storage.Drop()
+	backend, err := CreateStorage("test.sqlite", nil)
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
 	if err != nil {
 		t.Error(err)
 	}
@@ -101,12 +107,13 @@ func TestSqlite(t *testing.T) {
 		t.Error(err)
 	}
 
-	last, err := storage.GetLast(1, 0)
+	result, err := storage.GetLast(1, "")
 
 	if err != nil {
 		t.Fatal(err)
 		return
 	}
+	last := result.Repetitions
 
 	expected := reps[len(reps)-1]
 	if len(last) == 0 {
@@ -211,3 +218,1173 @@ func TestSqlite(t *testing.T) {
 	}
 
 }
+
+func TestSqliteTrack(t *testing.T) {
+	backend, err := CreateStorage("test_track.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "run",
+			Volume:      2,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "miles",
+			Category:    "aerobic",
+		},
+	}
+	err = storage.Load(reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reps[0].ID == nil {
+		t.Fatal("Load did not set the ID of the inserted repetition")
+	}
+
+	track := lifting.Track{RepetitionID: *reps[0].ID, Format: "gpx", Data: []byte("<gpx></gpx>")}
+	err = storage.AttachTrack(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := storage.GetTrack(*reps[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.Format != track.Format || string(found.Data) != string(track.Data) {
+		t.Fatal("mimsatch",
+			fmt.Sprintf("expected %#v", track),
+			fmt.Sprintf("found %#v", found),
+		)
+	}
+
+	err = storage.Delete(*reps[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// kept in case the repetition is restored.
+	_, err = storage.GetTrack(*reps[0].ID)
+	if err != nil {
+		t.Fatal("track was deleted along with its repetition", err)
+	}
+
+	_, err = storage.Purge(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = storage.GetTrack(*reps[0].ID)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("track outlived its repetition", found, err)
+	}
+}
+
+func TestSqliteLoadWithTrack(t *testing.T) {
+	ctx := context.Background()
+	backend, err := CreateStorage("test_load_with_track.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+
+	run := lifting.Repetition{
+		Exercise:    "run",
+		Volume:      2,
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+		Units:       "miles",
+	}
+	// a track has to have data, so attaching it fails.
+	if err = backend.LoadWithTrack(ctx, &run, lifting.Track{Format: "gpx"}); err == nil {
+		t.Fatal("expected a track without data to fail")
+	}
+	last, err := backend.GetLast(ctx, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last.Repetitions) != 0 || run.ID != nil {
+		t.Fatal("expected the run not to be stored without its track", last.Repetitions)
+	}
+
+	if err = backend.LoadWithTrack(ctx, &run, lifting.Track{Format: "gpx", Data: []byte("<gpx></gpx>")}); err != nil {
+		t.Fatal(err)
+	}
+	track, err := backend.GetTrack(ctx, *run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(track.Data) != "<gpx></gpx>" {
+		t.Fatal("mimsatch", "expected the track attached", fmt.Sprintf("found %#v", track))
+	}
+}
+
+func TestSqliteBetween(t *testing.T) {
+	backend, err := CreateStorage("test_between.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "run",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "miles",
+		},
+		lifting.Repetition{
+			Exercise:    "squat",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 26},
+			Units:       "lbs",
+		},
+	}
+	err = storage.Load(reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	between, err := storage.GetBetween(civil.Date{Year: 2018, Month: 12, Day: 19}, civil.Date{Year: 2018, Month: 12, Day: 21})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(between) != 1 || between[0].Exercise != "run" {
+		t.Fatal("mimsatch",
+			fmt.Sprintf("expected %#v", reps[:1]),
+			fmt.Sprintf("found %#v", between),
+		)
+	}
+}
+
+func TestSqliteMeasurements(t *testing.T) {
+	backend, err := CreateStorage("test_measurements.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	ms := []lifting.Measurement{
+		lifting.Measurement{
+			Kind:  lifting.Bodyweight,
+			Value: 182.4,
+			Units: "lbs",
+			Date:  civil.Date{Year: 2018, Month: 12, Day: 20},
+		},
+		lifting.Measurement{
+			Kind:  lifting.Circumference,
+			Site:  "waist",
+			Value: 33,
+			Units: "in",
+			Date:  civil.Date{Year: 2018, Month: 12, Day: 20},
+		},
+	}
+	err = storage.LoadMeasurements(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ms[0].ID == nil || ms[1].ID == nil {
+		t.Fatal("LoadMeasurements did not set IDs", ms)
+	}
+
+	start, end := civil.Date{Year: 2018, Month: 12, Day: 1}, civil.Date{Year: 2018, Month: 12, Day: 31}
+
+	found, err := storage.GetMeasurements(lifting.Bodyweight, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || *found[0].ID != *ms[0].ID {
+		t.Fatal("mimsatch",
+			fmt.Sprintf("expected %#v", ms[:1]),
+			fmt.Sprintf("found %#v", found),
+		)
+	}
+	found[0].ID = ms[0].ID
+	if found[0] != ms[0] {
+		t.Fatal("mimsatch",
+			fmt.Sprintf("expected %#v", ms[0]),
+			fmt.Sprintf("found %#v", found[0]),
+		)
+	}
+
+	all, err := storage.GetMeasurements("", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatal("expected every kind", all)
+	}
+
+	err = storage.DeleteMeasurement(*ms[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err = storage.GetMeasurements("", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Fatal("expected the circumference to be deleted", all)
+	}
+}
+
+func TestSqliteSearch(t *testing.T) {
+	backend, err := CreateStorage("test_search.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "squat",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "lbs",
+			Weight:      225,
+			Effort:      7,
+			Comment:     "knees caved a bit",
+		},
+		lifting.Repetition{
+			Exercise:    "squat",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 22},
+			Units:       "lbs",
+			Weight:      245,
+			Effort:      9,
+			Failure:     true,
+			Comment:     "missed it, knees caved",
+		},
+		lifting.Repetition{
+			Exercise:    "bench",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 24},
+			Units:       "lbs",
+			Weight:      185,
+			Effort:      8,
+		},
+		lifting.Repetition{
+			Exercise:    "squat",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 26},
+			Units:       "lbs",
+			Weight:      235,
+			Effort:      8,
+		},
+	}
+	err = storage.Load(reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exercises := func(reps []lifting.Repetition) []string {
+		found := make([]string, len(reps))
+		for i, r := range reps {
+			found[i] = fmt.Sprintf("%s %d", r.Exercise, r.Weight)
+		}
+		return found
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    lifting.Query
+		expected []string
+	}{
+		{"newest", lifting.Query{}, []string{"squat 235", "bench 185", "squat 245", "squat 225"}},
+		{"oldest", lifting.Query{Sort: lifting.Oldest, Exercises: []string{"squat"}}, []string{"squat 225", "squat 245", "squat 235"}},
+		{"heaviest", lifting.Query{Sort: lifting.Heaviest}, []string{"squat 245", "squat 235", "squat 225", "bench 185"}},
+		{"effort", lifting.Query{MinEffort: 8, MaxEffort: 8}, []string{"squat 235", "bench 185"}},
+		{"weight", lifting.Query{MinWeight: 200, MaxWeight: 240}, []string{"squat 235", "squat 225"}},
+		{"failure", lifting.Query{FailureOnly: true}, []string{"squat 245"}},
+		{"text", lifting.Query{Text: "knees caved"}, []string{"squat 245", "squat 225"}},
+	} {
+		result, err := storage.Search(tc.query)
+		if err != nil {
+			t.Fatal(tc.name, err)
+		}
+		found := exercises(result.Repetitions)
+		if fmt.Sprint(found) != fmt.Sprint(tc.expected) || result.Next != "" {
+			t.Fatal("mimsatch", tc.name,
+				fmt.Sprintf("expected %#v", tc.expected),
+				fmt.Sprintf("found %#v, next %q", found, result.Next),
+			)
+		}
+	}
+
+	// paging through two at a time gets everything, heaviest first.
+	var (
+		query = lifting.Query{Sort: lifting.Heaviest, Count: 2}
+		found []string
+		pages int
+	)
+	for {
+		result, err := storage.Search(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, exercises(result.Repetitions)...)
+		pages++
+		if result.Next == "" {
+			break
+		}
+		query.Cursor = result.Next
+	}
+	expected := []string{"squat 245", "squat 235", "squat 225", "bench 185"}
+	if fmt.Sprint(found) != fmt.Sprint(expected) || pages != 2 {
+		t.Fatal("mimsatch",
+			fmt.Sprintf("expected %#v in 2 pages", expected),
+			fmt.Sprintf("found %#v in %d pages", found, pages),
+		)
+	}
+
+	_, err = storage.Search(lifting.Query{Cursor: "not a cursor"})
+	if err == nil {
+		t.Fatal("expected an error for a bad cursor")
+	}
+}
+
+func TestSqlitePaging(t *testing.T) {
+	backend, err := CreateStorage("test_paging.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	reps := make([]lifting.Repetition, 0)
+	for day := 1; day <= 5; day++ {
+		reps = append(reps, lifting.Repetition{
+			Exercise:    "squat",
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: day},
+			Units:       "lbs",
+			Weight:      200 + day,
+		})
+	}
+	err = storage.Load(reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weights := func(result lifting.Result) string {
+		found := make([]int, len(result.Repetitions))
+		for i, r := range result.Repetitions {
+			found[i] = r.Weight
+		}
+		return fmt.Sprint(found, result.Next != "", result.Previous != "")
+	}
+
+	first, err := storage.GetLast(2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := weights(first); found != "[205 204] true false" {
+		t.Fatal("mimsatch", "expected [205 204] with only a next page", fmt.Sprintf("found %s", found))
+	}
+
+	// a newer row doesn't shift the pages after the one we're on.
+	err = storage.Load([]lifting.Repetition{lifting.Repetition{
+		Exercise:    "squat",
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 6},
+		Units:       "lbs",
+		Weight:      206,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := storage.GetLast(2, first.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := weights(second); found != "[203 202] true true" {
+		t.Fatal("mimsatch", "expected [203 202] with both pages", fmt.Sprintf("found %s", found))
+	}
+
+	third, err := storage.GetLast(2, second.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := weights(third); found != "[201] false true" {
+		t.Fatal("mimsatch", "expected [201] with only a previous page", fmt.Sprintf("found %s", found))
+	}
+
+	back, err := storage.GetLast(2, third.Previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := weights(back); found != "[203 202] true true" {
+		t.Fatal("mimsatch", "expected [203 202] going back", fmt.Sprintf("found %s", found))
+	}
+
+	// going back from the second page finds the new row too.
+	back, err = storage.GetLast(2, second.Previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := weights(back); found != "[205 204] true true" {
+		t.Fatal("mimsatch", "expected [205 204] with the newer row before it", fmt.Sprintf("found %s", found))
+	}
+}
+
+func TestSqliteCancelled(t *testing.T) {
+	storage, err := CreateStorage("test_cancelled.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Drop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = storage.Load(ctx, []lifting.Repetition{lifting.Repetition{
+		Exercise:    "squat",
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+		Units:       "lbs",
+	}})
+	if err != context.Canceled {
+		t.Fatal("mimsatch",
+			fmt.Sprintf("expected %#v", context.Canceled),
+			fmt.Sprintf("found %#v", err),
+		)
+	}
+
+	_, err = storage.GetUniqueExercises(ctx)
+	if err != context.Canceled {
+		t.Fatal("mimsatch",
+			fmt.Sprintf("expected %#v", context.Canceled),
+			fmt.Sprintf("found %#v", err),
+		)
+	}
+
+	_, err = storage.GetLast(ctx, 10, "")
+	if err != context.Canceled {
+		t.Fatal("mimsatch",
+			fmt.Sprintf("expected %#v", context.Canceled),
+			fmt.Sprintf("found %#v", err),
+		)
+	}
+}
+
+func TestSqliteErrors(t *testing.T) {
+	backend, err := CreateStorage("test_errors.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	missing := 42
+
+	_, err = storage.GetByID(missing)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrNotFound), fmt.Sprintf("found %#v", err))
+	}
+
+	err = storage.Delete(missing)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrNotFound), fmt.Sprintf("found %#v", err))
+	}
+
+	_, err = storage.GetTrack(missing)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrNotFound), fmt.Sprintf("found %#v", err))
+	}
+
+	err = storage.Load([]lifting.Repetition{lifting.Repetition{
+		ID:          &missing,
+		Exercise:    "squat",
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+		Units:       "lbs",
+	}})
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrNotFound), fmt.Sprintf("found %#v", err))
+	}
+
+	err = storage.DeleteMeasurement(missing)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrNotFound), fmt.Sprintf("found %#v", err))
+	}
+
+	err = storage.Load([]lifting.Repetition{lifting.Repetition{Exercise: "yoga"}})
+	var invalid *lifting.InvalidRepetitionError
+	if !errors.Is(err, lifting.ErrInvalidRepetition) || !errors.As(err, &invalid) || invalid.Fields["SessionDate"] == "" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrInvalidRepetition), fmt.Sprintf("found %#v", err))
+	}
+
+	heavy := lifting.Repetition{Exercise: "squat", Weight: -135, SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20}}
+	err = storage.Load([]lifting.Repetition{{Exercise: "bench", SessionDate: heavy.SessionDate}, heavy})
+	if !errors.As(err, &invalid) || invalid.Fields["Weight"] == "" || invalid.Index != 1 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrInvalidRepetition), fmt.Sprintf("found %#v", err))
+	}
+	err = backend.LoadWithTrack(context.Background(), &heavy, lifting.Track{Format: "tcx"})
+	if !errors.As(err, &invalid) || invalid.Fields["Weight"] == "" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrInvalidRepetition), fmt.Sprintf("found %#v", err))
+	}
+
+	_, err = storage.Search(lifting.Query{Cursor: "not a cursor"})
+	if !errors.Is(err, lifting.ErrInvalidQuery) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrInvalidQuery), fmt.Sprintf("found %#v", err))
+	}
+
+	err = translate(sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique})
+	if !errors.Is(err, lifting.ErrConflict) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrConflict), fmt.Sprintf("found %#v", err))
+	}
+}
+
+func TestSqliteTrash(t *testing.T) {
+	backend, err := CreateStorage("test_trash.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "squat",
+			Weight:      180,
+			Volume:      5,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "lbs",
+			Category:    "strength",
+			Comment:     "felt heavy",
+		},
+		lifting.Repetition{
+			Exercise:    "bench",
+			Weight:      135,
+			Volume:      5,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 21},
+			Units:       "lbs",
+			Category:    "strength",
+		},
+	}
+	err = storage.Load(reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	squat := *reps[0].ID
+
+	err = storage.Delete(squat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = storage.GetByID(squat)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrNotFound), fmt.Sprintf("found %#v", err))
+	}
+	err = storage.Delete(squat)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("deleted twice", err)
+	}
+	err = storage.Load(reps[:1])
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("updated a deleted repetition", err)
+	}
+
+	exercises, err := storage.GetUniqueExercises()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exercises) != 1 || exercises[0] != "bench" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", []string{"bench"}), fmt.Sprintf("found %#v", exercises))
+	}
+	for _, q := range []lifting.Query{lifting.Query{}, lifting.Query{Text: "heavy"}} {
+		result, err := storage.Search(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range result.Repetitions {
+			if *r.ID == squat {
+				t.Fatal("found a deleted repetition searching", q)
+			}
+		}
+	}
+	between, err := storage.GetBetween(civil.Date{Year: 2018, Month: 12, Day: 1}, civil.Date{Year: 2018, Month: 12, Day: 31})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(between) != 1 {
+		t.Fatal("expected only the bench", between)
+	}
+	counted, err := storage.CountBetween(civil.Date{Year: 2018, Month: 12, Day: 1}, civil.Date{Year: 2018, Month: 12, Day: 31})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counted != 1 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 1), fmt.Sprintf("found %#v", counted))
+	}
+
+	trashed, err := storage.GetTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 1 || *trashed[0].ID != squat || trashed[0].Comment != "felt heavy" {
+		t.Fatal("expected the squat in the trash", trashed)
+	}
+	if since := time.Since(trashed[0].DeletedAt); since < -time.Minute || since > time.Minute {
+		t.Fatal("expected it to have just been deleted", trashed[0].DeletedAt)
+	}
+	counted, err = storage.CountTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counted != 1 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 1), fmt.Sprintf("found %#v", counted))
+	}
+
+	err = storage.Restore(squat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.Restore(squat)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("restored twice", err)
+	}
+	if _, err = storage.GetByID(squat); err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.Delete(squat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	purged, err := storage.Purge(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 0 {
+		t.Fatal("purged before the retention was up", purged)
+	}
+	purged, err = storage.Purge(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 1), fmt.Sprintf("found %#v", purged))
+	}
+	err = storage.Restore(squat)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("restored a purged repetition", err)
+	}
+}
+
+func TestSqliteNoUnits(t *testing.T) {
+	backend, err := CreateStorage("test_no_units.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	reps := []lifting.Repetition{{
+		Exercise:    "yoga",
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+		Category:    "mobility",
+	}}
+	if err = storage.Load(reps); err != nil {
+		t.Fatal("expected a repetition without units to be stored", err)
+	}
+	found, err := storage.GetByID(*reps[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Exercise != "yoga" || found.Units != "" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", reps[0]), fmt.Sprintf("found %#v", found))
+	}
+
+	// the date is the one thing the log can't do without.
+	if err = storage.Load([]lifting.Repetition{{Exercise: "yoga"}}); !errors.Is(err, lifting.ErrInvalidRepetition) {
+		t.Fatal("expected an invalid repetition", err)
+	}
+}
+
+func TestSqliteRest(t *testing.T) {
+	ctx := context.Background()
+	backend, err := CreateStorage("test_rest.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "bench",
+			Weight:      185,
+			Volume:      5,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 22},
+			Units:       "lbs",
+			Rest:        150 * time.Second,
+		},
+	}
+	if err = backend.Load(ctx, reps); err != nil {
+		t.Fatal(err)
+	}
+	found, err := backend.GetByID(ctx, *reps[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Rest != reps[0].Rest {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", reps[0].Rest), fmt.Sprintf("found %#v", found.Rest))
+	}
+}
+
+func TestSqliteClientID(t *testing.T) {
+	backend, err := CreateStorage("test_client_id.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	rep := lifting.Repetition{
+		Exercise:    "squat",
+		Weight:      180,
+		Volume:      5,
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+		Units:       "lbs",
+		Category:    "strength",
+		ClientID:    "phone-1",
+	}
+	reps := []lifting.Repetition{rep, {Exercise: "bench", SessionDate: rep.SessionDate, Units: "lbs"}}
+	if err = storage.Load(reps); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := storage.GetByClientID("phone-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *found.ID != *reps[0].ID || found.ClientID != "phone-1" {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", *reps[0].ID), fmt.Sprintf("found %#v", found))
+	}
+	if _, err = storage.GetByClientID("phone-2"); !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("expected not found", err)
+	}
+
+	// the same one sent again clashes rather than being stored twice.
+	if err = storage.Load([]lifting.Repetition{rep}); !errors.Is(err, lifting.ErrConflict) {
+		t.Fatal("expected a conflict", err)
+	}
+
+	// it's still found in the trash, so a retry doesn't bring it back.
+	if err = storage.Delete(*reps[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if found, err = storage.GetByClientID("phone-1"); err != nil || *found.ID != *reps[0].ID {
+		t.Fatal("expected to find it in the trash", found, err)
+	}
+}
+
+func TestSqliteChanges(t *testing.T) {
+	backend, err := CreateStorage("test_changes.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.AdaptWith(lifting.WithActor(context.Background(), "tester"), backend)
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "squat",
+			Weight:      180,
+			Volume:      5,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "lbs",
+			Category:    "strength",
+		},
+	}
+	err = storage.Load(reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := *reps[0].ID
+
+	reps[0].Weight = 185
+	err = storage.Load(reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.Delete(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.Restore(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := storage.GetChanges(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make([]lifting.Action, len(changes))
+	for i, c := range changes {
+		actions[i] = c.Action
+		if c.Actor != "tester" || c.RepetitionID != id {
+			t.Fatal("mimsatch", fmt.Sprintf("expected a change to %d by tester", id), fmt.Sprintf("found %#v", c))
+		}
+	}
+	expected := []lifting.Action{lifting.Inserted, lifting.Updated, lifting.Deleted, lifting.Restored}
+	if fmt.Sprint(actions) != fmt.Sprint(expected) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", expected), fmt.Sprintf("found %#v", actions))
+	}
+	diff, err := changes[1].Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 1 || diff[0] != (lifting.FieldChange{Field: "Weight", Before: "180", After: "185"}) {
+		t.Fatal("mimsatch", "expected the weight to change", fmt.Sprintf("found %#v", diff))
+	}
+	if changes[2].Before == nil || changes[2].After != nil || changes[2].Before.Weight != 185 {
+		t.Fatal("expected a snapshot of what was deleted", changes[2])
+	}
+
+	err = lifting.Revert(context.Background(), backend, id, changes[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := storage.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverted.Weight != 180 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 180), fmt.Sprintf("found %#v", reverted.Weight))
+	}
+
+	err = lifting.Revert(context.Background(), backend, id, changes[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.GetByID(id)
+	if !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("expected reverting to the delete to delete it", err)
+	}
+}
+
+func TestSqliteBackfillStamps(t *testing.T) {
+	ctx := context.Background()
+	backend, err := CreateStorage("test_backfill.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "squat",
+			Weight:      180,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "lbs",
+		},
+		lifting.Repetition{
+			Exercise:    "bench",
+			Weight:      135,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 21},
+			Units:       "lbs",
+		},
+	}
+	if err = backend.Load(ctx, reps); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := backend.GetChanges(ctx, *reps[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as if they were stored before there were stamps, and the bench before
+	// there was a change log.
+	if _, err = backend.db.Exec(`UPDATE workout SET created_at = NULL, updated_at = NULL, seq = NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backend.db.Exec(`DELETE FROM workout_change WHERE workout_id = ?`, *reps[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := CreateStorage("test_backfill.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	squat, err := migrated.GetByID(ctx, *reps[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if squat.Seq != changes[0].ID || !squat.CreatedAt.Equal(changes[0].At) || !squat.UpdatedAt.Equal(changes[0].At) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected it stamped with %#v", changes[0]), fmt.Sprintf("found %#v", squat))
+	}
+	bench, err := migrated.GetByID(ctx, *reps[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bench.Seq != 0 || civil.DateOf(bench.CreatedAt) != reps[1].SessionDate {
+		t.Fatal("mimsatch", "expected it stamped with its session date", fmt.Sprintf("found %#v", bench))
+	}
+}
+
+func TestSqliteUndo(t *testing.T) {
+	ctx := context.Background()
+	backend, err := CreateStorage("test_undo.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "squat",
+			Weight:      180,
+			Volume:      5,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "lbs",
+		},
+	}
+	if err = backend.Load(ctx, reps); err != nil {
+		t.Fatal(err)
+	}
+	id := *reps[0].ID
+	previous, err := backend.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reps[0].Weight = 185
+	if err = backend.Load(ctx, reps); err != nil {
+		t.Fatal(err)
+	}
+
+	undo, err := lifting.DecodeUndo(lifting.Undo{Revert: id, Change: previous.Seq}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = undo.Apply(ctx, backend); err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := backend.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverted.Weight != 180 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", 180), fmt.Sprintf("found %#v", reverted.Weight))
+	}
+
+	// a change to another repetition can't be used to overwrite this one.
+	undo = lifting.Undo{Revert: id + 1, Change: previous.Seq}
+	if err = undo.Apply(ctx, backend); !errors.Is(err, lifting.ErrNotFound) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrNotFound), fmt.Sprintf("found %#v", err))
+	}
+}
+
+func TestSqliteChangesSince(t *testing.T) {
+	backend, err := CreateStorage("test_changes_since.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+	storage := lifting.Adapt(backend)
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "squat",
+			Weight:      180,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "lbs",
+		},
+		lifting.Repetition{
+			Exercise:    "bench",
+			Weight:      135,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "lbs",
+		},
+	}
+	err = storage.Load(reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reps[0].Seq == 0 || reps[1].Seq <= reps[0].Seq || reps[0].CreatedAt.IsZero() {
+		t.Fatal("expected Load to stamp the repetitions", reps)
+	}
+
+	feed, err := storage.ChangesSince(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 2 || feed[1].ID != reps[1].Seq {
+		t.Fatal("expected both inserts", feed)
+	}
+	seq := feed[1].ID
+
+	feed, err = storage.ChangesSince(seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 0 {
+		t.Fatal("expected nothing new", feed)
+	}
+
+	created := reps[0].CreatedAt
+	reps[0].Weight = 185
+	err = storage.Load(reps[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.Delete(*reps[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err = storage.ChangesSince(seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 2 || feed[0].Action != lifting.Updated || feed[1].Action != lifting.Deleted {
+		t.Fatal("expected the update then the delete", feed)
+	}
+
+	found, err := storage.GetByID(*reps[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Seq != feed[0].ID || !found.CreatedAt.Equal(created) || found.UpdatedAt.Before(created) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected seq %d created %v", feed[0].ID, created), fmt.Sprintf("found %#v", found))
+	}
+}
+
+func TestSqliteBackup(t *testing.T) {
+	ctx := context.Background()
+	from, err := CreateStorage("test_backup_from.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Drop()
+	to, err := CreateStorage("test_backup_to.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Drop()
+
+	reps := []lifting.Repetition{
+		lifting.Repetition{
+			Exercise:    "run",
+			Volume:      3.1,
+			Elapsed:     civil.Time{Minute: 25},
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 20},
+			Units:       "miles",
+			Comment:     "parkrun",
+		},
+		lifting.Repetition{
+			Exercise:    "squat",
+			Weight:      180,
+			Volume:      5,
+			SessionDate: civil.Date{Year: 2018, Month: 12, Day: 21},
+			Units:       "lbs",
+		},
+	}
+	if err = from.Load(ctx, reps); err != nil {
+		t.Fatal(err)
+	}
+	if err = from.AttachTrack(ctx, lifting.Track{RepetitionID: *reps[0].ID, Format: "gpx", Data: []byte("<gpx></gpx>")}); err != nil {
+		t.Fatal(err)
+	}
+	if err = from.Delete(ctx, *reps[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	ms := []lifting.Measurement{{Kind: lifting.Bodyweight, Value: 180, Units: "lbs", Date: civil.Date{Year: 2018, Month: 12, Day: 20}}}
+	if err = from.LoadMeasurements(ctx, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := lifting.WriteBackup(ctx, from, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Records("repetitions.jsonl") != 2 || manifest.Records("tracks.jsonl") != 1 || manifest.Records("measurements.jsonl") != 1 {
+		t.Fatal("expected everything in the manifest", manifest)
+	}
+
+	damaged := append([]byte(nil), archive.Bytes()...)
+	damaged[len(damaged)/2] ^= 0xff
+	if _, err = lifting.RestoreBackup(ctx, to, bytes.NewReader(damaged)); !errors.Is(err, lifting.ErrInvalidBackup) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", lifting.ErrInvalidBackup), fmt.Sprintf("found %#v", err))
+	}
+
+	if _, err = lifting.RestoreBackup(ctx, to, bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := to.GetLast(ctx, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last.Repetitions) != 1 || last.Repetitions[0].Comment != "parkrun" || last.Repetitions[0].Elapsed != reps[0].Elapsed {
+		t.Fatal("expected the run back", last.Repetitions)
+	}
+	track, err := to.GetTrack(ctx, *last.Repetitions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(track.Data) != "<gpx></gpx>" {
+		t.Fatal("mimsatch", "expected the track back", fmt.Sprintf("found %#v", track))
+	}
+	trashed, err := to.GetTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 1 || trashed[0].Exercise != "squat" {
+		t.Fatal("expected the squat back in the trash", trashed)
+	}
+	original, err := from.GetTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// restoring keeps when it was deleted, rather than starting its time in
+	// the trash again.
+	if !trashed[0].DeletedAt.Equal(original[0].DeletedAt) || !trashed[0].CreatedAt.Equal(original[0].CreatedAt) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", original[0]), fmt.Sprintf("found %#v", trashed[0]))
+	}
+	found, err := to.GetMeasurements(ctx, "", civil.Date{Year: 2018, Month: 1, Day: 1}, civil.Date{Year: 2019, Month: 1, Day: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Value != 180 {
+		t.Fatal("expected the bodyweight back", found)
+	}
+
+	if _, err = lifting.RestoreBackup(ctx, to, bytes.NewReader(archive.Bytes())); !errors.Is(err, lifting.ErrConflict) {
+		t.Fatal("restored over an existing log", err)
+	}
+}
+
+func TestSqliteLoadBackupFails(t *testing.T) {
+	ctx := context.Background()
+	backend, err := CreateStorage("test_load_backup.sqlite", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Drop()
+
+	id := 1
+	backup := lifting.Backup{
+		Repetitions: []lifting.BackupRepetition{
+			{Repetition: lifting.Repetition{ID: &id, Exercise: "squat", Volume: 5, SessionDate: civil.Date{Year: 2018, Month: 12, Day: 21}}},
+			// no session date, so it can't be stored.
+			{Repetition: lifting.Repetition{Exercise: "bench", Volume: 5}},
+		},
+	}
+	var invalid *lifting.InvalidRepetitionError
+	if err = backend.LoadBackup(ctx, backup); !errors.As(err, &invalid) || invalid.Index != 1 {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", invalid), fmt.Sprintf("found %#v", err))
+	}
+
+	// none of it was loaded, so it can be tried again.
+	last, err := backend.GetLast(ctx, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last.Repetitions) != 0 {
+		t.Fatal("expected nothing to be loaded", last.Repetitions)
+	}
+	backup.Repetitions = backup.Repetitions[:1]
+	if err = backend.LoadBackup(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,152 @@
+package lifting
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// The templates, stylesheets and scripts are built into the binary, so it
+// runs from anywhere.
+var (
+	//go:embed web/templates/*.html
+	embeddedTemplates embed.FS
+	//go:embed web/static
+	embeddedStatic embed.FS
+)
+
+// layouts are the templates every page is parsed with.
+var layouts = []string{"base.html", "table.html"}
+
+// pages are the templates the handlers render, which have to be there.
+var pages = []string{
+	"404.html",
+	"analytics.html",
+	"delete.html",
+	"form.html",
+	"history.html",
+	"import.html",
+	"index.html",
+	"measurements.html",
+	"scores.html",
+	"search.html",
+	"session.html",
+	"something-bad.html",
+	"track.html",
+	"trash.html",
+}
+
+// TemplateFS is the templates built into the binary.
+func TemplateFS() fs.FS {
+	sub, err := fs.Sub(embeddedTemplates, "web/templates")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// StaticFS is the stylesheets and the web app's scripts built into the
+// binary.
+func StaticFS() fs.FS {
+	sub, err := fs.Sub(embeddedStatic, "web/static")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// Templates are the pages, each parsed with the layouts.
+type Templates struct {
+	fsys fs.FS
+	// reload parses the templates again for every page, to see edits without
+	// a restart.
+	reload bool
+
+	mu    sync.Mutex
+	pages map[string]*template.Template
+}
+
+// LoadTemplates parses the templates in fsys, failing if any of the pages are
+// missing or broken. With reload, they're parsed again every time a page is
+// rendered.
+func LoadTemplates(fsys fs.FS, reload bool) (*Templates, error) {
+	t := &Templates{fsys: fsys, reload: reload}
+	pages, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	t.pages = pages
+	return t, nil
+}
+
+// DevTemplates loads the templates from a directory and reloads them when
+// they're rendered, for working on them.
+func DevTemplates(dir string) (*Templates, error) {
+	return LoadTemplates(os.DirFS(dir), true)
+}
+
+func (t *Templates) parse() (map[string]*template.Template, error) {
+	names, err := fs.Glob(t.fsys, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(names))
+	for _, name := range names {
+		found[name] = true
+	}
+	for _, name := range append(layouts, pages...) {
+		if !found[name] {
+			return nil, fmt.Errorf("template %s is missing", name)
+		}
+	}
+
+	parsed := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		if isLayout(name) {
+			continue
+		}
+		files := append([]string{name}, layouts...)
+		tpl, err := template.New(name).ParseFS(t.fsys, files...)
+		if err != nil {
+			return nil, err
+		}
+		// the page fills in the layout.
+		if tpl.Lookup("content") == nil {
+			return nil, fmt.Errorf("template %s doesn't define content", name)
+		}
+		parsed[name] = tpl
+	}
+	return parsed, nil
+}
+
+func isLayout(name string) bool {
+	for _, layout := range layouts {
+		if name == layout {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute renders a page.
+func (t *Templates) Execute(w io.Writer, name string, data interface{}) error {
+	t.mu.Lock()
+	if t.reload {
+		pages, err := t.parse()
+		if err != nil {
+			t.mu.Unlock()
+			return err
+		}
+		t.pages = pages
+	}
+	tpl, ok := t.pages[name]
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("template %s is missing", name)
+	}
+	return tpl.ExecuteTemplate(w, name, data)
+}
@@ -0,0 +1,52 @@
+package lifting
+
+import (
+	"bytes"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTemplates(t *testing.T) {
+	templates, err := LoadTemplates(TemplateFS(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err = templates.Execute(&out, "404.html", Context{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "/stylesheets/lift.css") {
+		t.Fatal("expected the page in the layout, found", out.String())
+	}
+	if _, err = fs.Stat(StaticFS(), "stylesheets/lift.css"); err != nil {
+		t.Fatal(err)
+	}
+
+	files := fstest.MapFS{}
+	for _, name := range append(layouts, pages...) {
+		data, err := fs.ReadFile(TemplateFS(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = &fstest.MapFile{Data: data}
+	}
+	if _, err = LoadTemplates(files, false); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := fstest.MapFS{}
+	for name, file := range files {
+		missing[name] = file
+	}
+	delete(missing, "index.html")
+	if _, err = LoadTemplates(missing, false); err == nil || !strings.Contains(err.Error(), "index.html") {
+		t.Fatal("expected index.html to be missing, found", err)
+	}
+
+	files["index.html"] = &fstest.MapFile{Data: []byte(`{{ define "content" }}{{ .History `)}
+	if _, err = LoadTemplates(files, false); err == nil {
+		t.Fatal("expected a broken index.html to fail")
+	}
+}
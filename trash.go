@@ -0,0 +1,81 @@
+package lifting
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DefaultRetention is how long deleted repetitions stay in the trash before
+// they are purged.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Trashed is a deleted repetition, waiting in the trash to be restored or
+// purged.
+type Trashed struct {
+	Repetition
+	DeletedAt time.Time
+}
+
+// ExpiresAt is when the repetition will be purged if it's kept for retention.
+func (t Trashed) ExpiresAt(retention time.Duration) time.Time {
+	return t.DeletedAt.Add(retention)
+}
+
+// Undo takes back a change to a repetition. It is handed out as an opaque
+// token after the change so it can be undone later.
+type Undo struct {
+	// Restore is the ID of a deleted repetition to take back out of the trash.
+	Restore int `json:"r,omitempty"`
+	// Revert is the ID of an edited repetition, and Change the change in its
+	// log that left it how it was before the edit.
+	Revert int `json:"v,omitempty"`
+	Change int `json:"c,omitempty"`
+}
+
+// Encode makes the undo into a token for a url.
+func (u Undo) Encode() string {
+	data, _ := json.Marshal(u)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeUndo reads an undo back out of a token.
+func DecodeUndo(token string) (Undo, error) {
+	var u Undo
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return u, fmt.Errorf("%w: bad undo %q", ErrInvalidQuery, token)
+	}
+	if err = json.Unmarshal(data, &u); err != nil {
+		return u, fmt.Errorf("%w: bad undo %q", ErrInvalidQuery, token)
+	}
+	if u.Restore == 0 && (u.Revert == 0 || u.Change == 0) {
+		return u, fmt.Errorf("%w: undo %q has nothing to undo", ErrInvalidQuery, token)
+	}
+	return u, nil
+}
+
+// Message describes the change the undo takes back.
+func (u Undo) Message() string {
+	if u.Revert != 0 {
+		return fmt.Sprintf("saved your changes to repetition %d", u.Revert)
+	}
+	return fmt.Sprintf("moved repetition %d to the trash", u.Restore)
+}
+
+// Apply undoes the change, reverting an edit through the change log so only
+// a version the repetition really had can be put back.
+func (u Undo) Apply(ctx context.Context, s ContextStorage) error {
+	if u.Revert != 0 {
+		return Revert(ctx, s, u.Revert, u.Change)
+	}
+	return s.Restore(ctx, u.Restore)
+}
+
+// PurgeExpired permanently removes what has been in the trash for longer than
+// the retention.
+func PurgeExpired(ctx context.Context, s ContextStorage, retention time.Duration) (int, error) {
+	return s.Purge(ctx, time.Now().Add(-retention))
+}
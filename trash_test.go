@@ -0,0 +1,25 @@
+package lifting
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	for _, u := range []Undo{Undo{Restore: 3}, Undo{Revert: 3, Change: 7}} {
+		decoded, err := DecodeUndo(u.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != u {
+			t.Fatal("mimsatch", fmt.Sprintf("expected %#v", u), fmt.Sprintf("found %#v", decoded))
+		}
+	}
+
+	for _, token := range []string{"", "not a token", Undo{}.Encode(), Undo{Revert: 3}.Encode()} {
+		if _, err := DecodeUndo(token); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatal("expected an invalid undo for", token, err)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package lifting
 
 import (
+	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/civil"
@@ -87,7 +89,9 @@ func (s Groups) Less(i, j int) bool {
 	return false
 }
 
-func group(reps []Repetition) Groups {
+// GroupByDate groups the reps by date and then category, newest first, the
+// way the history is shown.
+func GroupByDate(reps []Repetition) Groups {
 	m := mapGroup(reps)
 
 	gs := make(Groups, 0)
@@ -108,3 +112,36 @@ func group(reps []Repetition) Groups {
 	return gs
 
 }
+
+// sparkline scales the values into a width by height box and formats them as
+// svg polyline points. The smallest value is drawn at the top.
+func sparkline(values []float64, width, height float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	span := max - min
+	if span == 0 {
+		span = 1
+	}
+
+	step := 0.0
+	if len(values) > 1 {
+		step = width / float64(len(values)-1)
+	}
+
+	points := make([]string, len(values))
+	for i, v := range values {
+		points[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*step, (v-min)/span*height)
+	}
+	return strings.Join(points, " ")
+}
@@ -87,7 +87,7 @@ func TestGrouping(t *testing.T) {
 		},
 	}
 
-	group(reps)
+	GroupByDate(reps)
 
 
 
@@ -0,0 +1,70 @@
+package lifting
+
+import (
+	"errors"
+
+	"cloud.google.com/go/civil"
+)
+
+// The range efforts are given in, from asleep to all out.
+const (
+	MinEffort = 0
+	MaxEffort = 100
+)
+
+// ValidateEffort checks the effort is in range.
+func ValidateEffort(effort int) error {
+	if effort < MinEffort || effort > MaxEffort {
+		return errors.New("must be between 0 and 100")
+	}
+	return nil
+}
+
+// ValidateAmount checks a volume, weight or count of sets isn't negative.
+func ValidateAmount(amount float64) error {
+	if amount < 0 {
+		return errors.New("can't be negative")
+	}
+	return nil
+}
+
+// ValidateElapsed checks the elapsed time is a real time of day, so it can be
+// stored as one.
+func ValidateElapsed(elapsed civil.Time) error {
+	if !elapsed.IsValid() {
+		return errors.New("must be a duration under 24 hours")
+	}
+	return nil
+}
+
+// Validate checks the repetition makes sense before it's stored, returning an
+// *InvalidRepetitionError listing the problems with each field if it doesn't.
+// The backends check it as they store it, see RepetitionToWorkout, and the
+// forms and prompts check it first to ask again.
+func (r Repetition) Validate() error {
+	problems := make(map[string]string)
+	check := func(field string, err error) {
+		if err != nil {
+			problems[field] = err.Error()
+		}
+	}
+
+	if r.Exercise == "" {
+		problems["Exercise"] = "must be set"
+	}
+	if r.SessionDate == (civil.Date{}) {
+		problems["SessionDate"] = "must be set"
+	} else if !r.SessionDate.IsValid() {
+		problems["SessionDate"] = "must be a real date"
+	}
+	check("Effort", ValidateEffort(r.Effort))
+	check("Volume", ValidateAmount(r.Volume))
+	check("Weight", ValidateAmount(float64(r.Weight)))
+	check("Sets", ValidateAmount(float64(r.Sets)))
+	check("Elapsed", ValidateElapsed(r.Elapsed))
+
+	if len(problems) > 0 {
+		return &InvalidRepetitionError{Repetition: r, Fields: problems}
+	}
+	return nil
+}
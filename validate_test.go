@@ -0,0 +1,56 @@
+package lifting
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/civil"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Repetition{
+		Exercise:    "squat",
+		Effort:      70,
+		Volume:      5,
+		Weight:      180,
+		SessionDate: civil.Date{Year: 2018, Month: 12, Day: 25},
+		Units:       "lbs",
+		Category:    "strength",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatal("expected a valid repetition", err)
+	}
+
+	// yoga or mobility work has nothing to measure it in.
+	unitless := valid
+	unitless.Units = ""
+	if err := unitless.Validate(); err != nil {
+		t.Fatal("expected a repetition without units to be valid", err)
+	}
+
+	invalid := valid
+	invalid.Exercise = ""
+	invalid.Effort = 101
+	invalid.Weight = -5
+	invalid.SessionDate = civil.Date{Year: 2018, Month: 2, Day: 30}
+	invalid.Elapsed = civil.Time{Hour: 25}
+
+	err := invalid.Validate()
+	if !errors.Is(err, ErrInvalidRepetition) {
+		t.Fatal("expected an invalid repetition, found", err)
+	}
+
+	var invalidErr *InvalidRepetitionError
+	errors.As(err, &invalidErr)
+	expected := map[string]string{
+		"Exercise":    "must be set",
+		"Effort":      "must be between 0 and 100",
+		"Weight":      "can't be negative",
+		"SessionDate": "must be a real date",
+		"Elapsed":     "must be a duration under 24 hours",
+	}
+	if fmt.Sprint(invalidErr.Fields) != fmt.Sprint(expected) {
+		t.Fatal("mimsatch", fmt.Sprintf("expected %#v", expected), fmt.Sprintf("found %#v", invalidErr.Fields))
+	}
+}
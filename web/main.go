@@ -1,29 +1,36 @@
+// Command web serves the web app from postgres, with the same flags and
+// LIFT_* environment variables as `lift serve`, for running it where the lift
+// command line isn't wanted.
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/awinterman/lifting"
 	"github.com/awinterman/lifting/postgres"
 )
 
 func main() {
-	var storage, err = postgres.CreateStorage("user=andrew password=andrew dbname=andrew", nil)
+	var config lifting.ServerConfig
+	dsn := flag.String("db", os.Getenv("LIFT_DB"), "postgres connection string, LIFT_DB")
+	config.AddFlags(flag.CommandLine)
+	flag.Parse()
+	config.Logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
 
+	storage, err := postgres.CreateStorage(*dsn, nil)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 
-	mux := http.NewServeMux()
-	fs := http.FileServer(http.Dir("./static/"))
-
-	handlers := lifting.Handlers{Storage: storage, Step: 10}
-
-	mux.Handle("/stylesheets/", fs)
-	mux.HandleFunc("/", handlers.Handle)
-
-	port := ":9000"
-	log.Printf("Listening http://localhost:%v", port)
-	http.ListenAndServe(port, mux)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err = lifting.Serve(ctx, storage, config); err != nil {
+		log.Fatal(err)
+	}
 }
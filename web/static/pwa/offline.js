@@ -0,0 +1,99 @@
+// offline.js installs the service worker, and logs repetitions to the outbox
+// when there's no signal, sending them when it comes back.
+(function () {
+  if (!("serviceWorker" in navigator) || !("indexedDB" in window)) {
+    return;
+  }
+  navigator.serviceWorker.register("/sw.js");
+
+  function pad(n) {
+    n = parseInt(n || "0", 10) || 0;
+    return (n < 10 ? "0" : "") + n;
+  }
+
+  function number(value, parse) {
+    return value === "" || value == null ? 0 : parse(value);
+  }
+
+  // formRepetition reads the add exercise form into a repetition, in the
+  // shape the JSON API takes.
+  function formRepetition(form) {
+    var data = new FormData(form);
+    return {
+      Category: data.get("Category") || "",
+      SessionDate: data.get("SessionDate") || "",
+      Exercise: data.get("Exercise") || "",
+      Volume: number(data.get("Volume"), parseFloat),
+      Sets: number(data.get("Sets"), parseInt),
+      Weight: number(data.get("Weight"), parseInt),
+      Units: data.get("Units") || "",
+      Elapsed: pad(data.get("DurationHour")) + ":" + pad(data.get("DurationMinute")) + ":" + pad(data.get("DurationSecond")),
+      Effort: number(data.get("Effort"), parseInt),
+      Failure: data.get("Failure") != null,
+      Comment: (data.get("Comment") || "").trim(),
+      QueuedAt: Date.now(),
+    };
+  }
+
+  function banner(text) {
+    var el = document.getElementById("outbox-status");
+    if (!el) {
+      el = document.createElement("p");
+      el.id = "outbox-status";
+      el.className = "outbox";
+      document.body.insertBefore(el, document.body.firstChild);
+    }
+    el.textContent = text;
+  }
+
+  function showQueued() {
+    outbox.all().then(function (queued) {
+      if (queued.length > 0) {
+        banner(queued.length + " logged offline, waiting for signal to save.");
+      }
+    });
+  }
+
+  function sync() {
+    outbox.flush().then(function (result) {
+      var text = [];
+      if (result.sent > 0) {
+        text.push("saved " + result.sent + " logged offline.");
+      }
+      result.rejected.forEach(function (r) {
+        text.push("couldn't save " + r.repetition.Exercise + " from " + r.repetition.SessionDate + ": " + r.problem.Error);
+      });
+      if (text.length > 0) {
+        banner(text.join(" "));
+      } else {
+        showQueued();
+      }
+    });
+  }
+
+  // only adding a new exercise is queued; edits need the server.
+  document.addEventListener("submit", function (event) {
+    var form = event.target;
+    if (navigator.onLine || !form.matches("form.repetition:not([data-id])")) {
+      return;
+    }
+    event.preventDefault();
+    outbox.add(formRepetition(form)).then(function () {
+      form.reset();
+      showQueued();
+      return navigator.serviceWorker.ready;
+    }).then(function (registration) {
+      // where there's background sync, it's sent even if the page is closed.
+      if (registration.sync) {
+        return registration.sync.register("outbox");
+      }
+    });
+  });
+
+  window.addEventListener("online", sync);
+  if (navigator.onLine) {
+    sync();
+  } else {
+    showQueued();
+  }
+})();
@@ -0,0 +1,93 @@
+// The outbox keeps repetitions logged offline in IndexedDB until they can be
+// sent to /api/repetitions. Each has a ClientID made up when it was logged, so
+// sending one again after a dropped response doesn't store it twice. Both the
+// pages and the service worker load this.
+var outbox = (function () {
+  var DB = "lifting";
+  var STORE = "outbox";
+
+  function open() {
+    return new Promise(function (resolve, reject) {
+      var request = indexedDB.open(DB, 1);
+      request.onupgradeneeded = function () {
+        request.result.createObjectStore(STORE, { keyPath: "ClientID" });
+      };
+      request.onsuccess = function () { resolve(request.result); };
+      request.onerror = function () { reject(request.error); };
+    });
+  }
+
+  function run(mode, f) {
+    return open().then(function (db) {
+      return new Promise(function (resolve, reject) {
+        var tx = db.transaction(STORE, mode);
+        var result = f(tx.objectStore(STORE));
+        tx.oncomplete = function () { resolve(result && result.result); };
+        tx.onerror = function () { reject(tx.error); };
+      });
+    });
+  }
+
+  function newClientID() {
+    if (self.crypto && crypto.randomUUID) {
+      return crypto.randomUUID();
+    }
+    return Date.now().toString(36) + "-" + Math.random().toString(36).slice(2);
+  }
+
+  // add queues a repetition, giving it a ClientID if it hasn't one.
+  function add(repetition) {
+    repetition.ClientID = repetition.ClientID || newClientID();
+    return run("readwrite", function (store) {
+      return store.put(repetition);
+    }).then(function () { return repetition; });
+  }
+
+  function all() {
+    return run("readonly", function (store) { return store.getAll(); });
+  }
+
+  function remove(clientID) {
+    return run("readwrite", function (store) { return store.delete(clientID); });
+  }
+
+  // flush sends everything queued, oldest first, stopping at the first that
+  // can't get through. What the server turns down as invalid is dropped, as
+  // sending it again won't help; it's kept with the problem in rejected.
+  function flush() {
+    var sent = 0;
+    var rejected = [];
+    return all().then(function (queued) {
+      queued.sort(function (a, b) { return (a.QueuedAt || 0) - (b.QueuedAt || 0); });
+      return queued.reduce(function (previous, repetition) {
+        return previous.then(function () {
+          var body = Object.assign({}, repetition);
+          delete body.QueuedAt;
+          return fetch("/api/repetitions", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(body),
+          }).then(function (response) {
+            if (response.ok) {
+              sent++;
+              return remove(repetition.ClientID);
+            }
+            if (response.status === 400) {
+              return response.json().then(function (problem) {
+                rejected.push({ repetition: repetition, problem: problem });
+                return remove(repetition.ClientID);
+              });
+            }
+            throw new Error("storing " + repetition.ClientID + ": " + response.status);
+          });
+        });
+      }, Promise.resolve());
+    }).then(function () {
+      return { sent: sent, rejected: rejected };
+    }, function (err) {
+      return { sent: sent, rejected: rejected, error: err };
+    });
+  }
+
+  return { add: add, all: all, flush: flush };
+})();
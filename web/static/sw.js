@@ -0,0 +1,69 @@
+// The service worker keeps the pages you need in the gym cached: the add
+// exercise form and the latest history come from the network when there is
+// one and the cache when there isn't. It sends the outbox when the browser
+// says there's signal again.
+importScripts("/pwa/outbox.js");
+
+var CACHE = "lifting-v1";
+var PAGES = ["/", "/create/", "/session/"];
+var ASSETS = [
+  "/stylesheets/normalize.css",
+  "/stylesheets/sakura.css",
+  "/stylesheets/lift.css",
+  "/stylesheets/slider.css",
+  "/pwa/outbox.js",
+  "/pwa/offline.js",
+  "/pwa/icon.svg",
+  "/manifest.webmanifest",
+];
+
+self.addEventListener("install", function (event) {
+  event.waitUntil(caches.open(CACHE).then(function (cache) {
+    return cache.addAll(PAGES.concat(ASSETS));
+  }).then(function () {
+    return self.skipWaiting();
+  }));
+});
+
+self.addEventListener("activate", function (event) {
+  event.waitUntil(caches.keys().then(function (keys) {
+    return Promise.all(keys.filter(function (key) { return key !== CACHE; }).map(function (key) {
+      return caches.delete(key);
+    }));
+  }).then(function () {
+    return self.clients.claim();
+  }));
+});
+
+self.addEventListener("fetch", function (event) {
+  var request = event.request;
+  var url = new URL(request.url);
+  if (request.method !== "GET" || url.origin !== self.location.origin) {
+    return;
+  }
+  if (ASSETS.indexOf(url.pathname) >= 0) {
+    event.respondWith(caches.match(request).then(function (cached) {
+      return cached || fetch(request);
+    }));
+    return;
+  }
+  if (request.mode === "navigate") {
+    event.respondWith(fetch(request).then(function (response) {
+      if (response.ok && PAGES.indexOf(url.pathname) >= 0) {
+        var copy = response.clone();
+        caches.open(CACHE).then(function (cache) { cache.put(url.pathname, copy); });
+      }
+      return response;
+    }, function () {
+      return caches.match(url.pathname).then(function (cached) {
+        return cached || caches.match("/");
+      });
+    }));
+  }
+});
+
+self.addEventListener("sync", function (event) {
+  if (event.tag === "outbox") {
+    event.waitUntil(outbox.flush());
+  }
+});